@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gomicsv
+
+import (
+	"time"
+
+	"github.com/gotk3/gotk3/glib"
+
+	"github.com/fauu/gomicsv/pixbuf"
+)
+
+// Frames are shown for at least this long, as is customary for GIFs declaring shorter delays
+const minAnimationFrameDelay = 20 * time.Millisecond
+
+// pageAnimation plays an animated page, keeping PixbufL or PixbufR at its current frame
+type pageAnimation struct {
+	anim    *pixbuf.Animation
+	right   bool // Whether it is the animation of PixbufR
+	timeout *glib.SourceHandle
+}
+
+// animationsStart starts playing the currently loaded pages, if they are animated
+func (app *App) animationsStart() {
+	app.animationsStop()
+
+	if anim := pixbuf.AnimationOf(app.S.PixbufL); anim != nil {
+		app.S.Animations = append(app.S.Animations, &pageAnimation{anim: anim})
+	}
+	if anim := pixbuf.AnimationOf(app.S.PixbufR); anim != nil {
+		app.S.Animations = append(app.S.Animations, &pageAnimation{anim: anim, right: true})
+	}
+
+	if !app.S.AnimationPaused {
+		for _, pa := range app.S.Animations {
+			app.animationSchedule(pa)
+		}
+	}
+	app.W.MenuItemAnimationStep.SetSensitive(len(app.S.Animations) > 0)
+}
+
+func (app *App) animationsStop() {
+	for _, pa := range app.S.Animations {
+		app.animationUnschedule(pa)
+	}
+	app.S.Animations = nil
+	app.W.MenuItemAnimationStep.SetSensitive(false)
+}
+
+func (app *App) animationSchedule(pa *pageAnimation) {
+	delay := pa.anim.Delay()
+	if delay < 0 || pa.timeout != nil {
+		return
+	}
+	delay = max(delay, minAnimationFrameDelay)
+
+	handle := glib.TimeoutAdd(uint(delay.Milliseconds()), func() bool {
+		pa.timeout = nil
+		app.animationAdvance(pa)
+		if !app.S.AnimationPaused {
+			app.animationSchedule(pa)
+		}
+		return false
+	})
+	pa.timeout = &handle
+}
+
+func (app *App) animationUnschedule(pa *pageAnimation) {
+	if pa.timeout != nil {
+		glib.SourceRemove(*pa.timeout)
+		pa.timeout = nil
+	}
+}
+
+// animationAdvance shows the next frame of the animation
+func (app *App) animationAdvance(pa *pageAnimation) {
+	if !pa.anim.Advance() {
+		return
+	}
+
+	frame, err := pa.anim.Frame()
+	if err != nil {
+		app.showError(err.Error())
+		return
+	}
+	if pa.right {
+		app.S.PixbufR = frame
+	} else {
+		app.S.PixbufL = frame
+	}
+
+	app.blitPages()
+}
+
+func (app *App) setAnimationPaused(paused bool) {
+	app.S.AnimationPaused = paused
+	for _, pa := range app.S.Animations {
+		if paused {
+			app.animationUnschedule(pa)
+		} else {
+			app.animationSchedule(pa)
+		}
+	}
+}
+
+// animationStep pauses the animations and shows their next frames
+func (app *App) animationStep() {
+	if len(app.S.Animations) == 0 {
+		return
+	}
+	app.W.MenuItemAnimationPause.SetActive(true)
+	for _, pa := range app.S.Animations {
+		app.animationAdvance(pa)
+	}
+}
@@ -19,6 +19,7 @@
 package gomicsv
 
 import (
+	"context"
 	_ "embed"
 	"fmt"
 	"log"
@@ -31,8 +32,10 @@ import (
 	"github.com/gotk3/gotk3/gtk"
 
 	"github.com/fauu/gomicsv/archive"
+	"github.com/fauu/gomicsv/httpcache"
 	"github.com/fauu/gomicsv/imgdiff"
 	"github.com/fauu/gomicsv/pagecache"
+	"github.com/fauu/gomicsv/pixbuf"
 	"github.com/fauu/gomicsv/util"
 )
 
@@ -55,12 +58,25 @@ type State struct {
 	ArchivePos                          int
 	ArchivePath                         string
 	PixbufL, PixbufR                    *gdk.Pixbuf
+	Animations                          []*pageAnimation
+	AnimationPaused                     bool
 	GoToThumbPixbuf                     *gdk.Pixbuf
 	Scale                               float64
 	PageCache                           *pagecache.PageCache
+	HTTPCache                           *httpcache.HTTPCache // Nil if it couldn't be opened
+	PageLoadCancel                      context.CancelFunc
+	URLTemplateInferenceCancel          context.CancelFunc
+	ArchiveOpenCancel                   context.CancelFunc // For HTTP archives, which are opened in the background
+	ArchiveOpenURL                      string             // The URL of the HTTP archive being opened
+	PageSpinnerTimeout                  *glib.SourceHandle
+	PrefetchCancel                      context.CancelFunc
+	PrefetchPos                         int // Page the last prefetching was around
+	NextArchive                         *preparedArchive
+	HTTPReferer                         string // The referer given when the current archive was opened from a URL
 	ConfigDirPath                       string
 	UserDataDirPath                     string
 	ReadLaterDirPath                    string
+	PasswordsDirPath                    string
 	ImageHashes                         map[int]imgdiff.Hash
 	Jumpmarks                           Jumpmarks
 	Cursor                              CursorsState
@@ -69,9 +85,10 @@ type State struct {
 	KamiteRightClickActionPending       bool
 	RecentManager                       *gtk.RecentManager
 	BackgroundColorCssProvider          *gtk.CssProvider
-	PageCacheTrimTimeoutHandle          *glib.SourceHandle
 	UITemporarilyRevealed               bool
 	MirrorNavigationButtonsTextReversed bool
+	RecursiveDirForced                  bool // Set from the command line, regardless of the config
+	MangaModeForced                     bool // Set for the current archive from its metadata, regardless of the config
 }
 
 //go:embed about.jpg
@@ -84,7 +101,8 @@ var iconImg []byte
 var uiDef string
 
 type AppStartupParams struct {
-	Referer string
+	Referer      string
+	RecursiveDir bool
 }
 
 func (app *App) Init(nonFlagArgs []string, startupParams AppStartupParams, buildInfo BuildInfo) *gtk.Application {
@@ -95,12 +113,17 @@ func (app *App) Init(nonFlagArgs []string, startupParams AppStartupParams, build
 	glib.SetPrgname(AppID)
 
 	app.S.BuildInfo = buildInfo
+	app.S.RecursiveDirForced = startupParams.RecursiveDir
 
 	application.Connect("startup", func(self *gtk.Application) {
+		archive.SetImageExtensions(pixbuf.Extensions())
+
 		app.ensureDirs()
 
 		app.loadConfig()
 
+		app.httpCacheInit()
+
 		app.S.RecentManager, err = gtk.RecentManagerGetDefault()
 		if err != nil {
 			log.Panicf("getting default RecentManager: %v", err)
@@ -129,7 +152,7 @@ func (app *App) Init(nonFlagArgs []string, startupParams AppStartupParams, build
 		path := file.GetPath()
 		// `path` is empty when an URL is passed. In such case, try to get the URL directly from `args`
 		if path == "" && len(nonFlagArgs) >= 2 && util.IsLikelyHTTPURL(nonFlagArgs[1]) {
-			app.loadArchiveFromURL(nonFlagArgs[1], startupParams.Referer)
+			app.openURL(nonFlagArgs[1], startupParams.Referer)
 		} else {
 			app.loadArchiveFromPath(path)
 		}
@@ -153,6 +176,7 @@ func (app *App) ensureDirs() {
 	app.S.ConfigDirPath = configPath
 	app.S.UserDataDirPath = userDataPath
 	app.S.ReadLaterDirPath = filepath.Join(userDataPath, ReadLaterDir)
+	app.S.PasswordsDirPath = filepath.Join(userDataPath, PasswordsDir)
 
 	if err := os.MkdirAll(app.S.ConfigDirPath, 0755); err != nil {
 		log.Panicf("creting config directory: %v", err)
@@ -165,6 +189,10 @@ func (app *App) ensureDirs() {
 	if err := os.MkdirAll(app.S.ReadLaterDirPath, 0755); err != nil {
 		log.Panicf("creating read later directory: %v", err)
 	}
+
+	if err := os.MkdirAll(app.S.PasswordsDirPath, 0700); err != nil {
+		log.Panicf("creating passwords directory: %v", err)
+	}
 }
 
 func (app *App) syncStateToConfig() {
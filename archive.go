@@ -19,6 +19,8 @@
 package gomicsv
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/url"
@@ -36,32 +38,108 @@ import (
 )
 
 func (app *App) loadArchiveFromURL(url string, httpReferer string) {
-	app.doLoadArchive(url, true, httpReferer)
+	app.loadArchiveFromURLThen(url, httpReferer, nil)
+}
+
+// loadArchiveFromURLThen opens the archive at url in the background, since that involves making
+// requests, calling then once it's loaded. The current archive stays open in the meantime
+func (app *App) loadArchiveFromURLThen(url string, httpReferer string, then func()) {
+	if strings.TrimSpace(url) == "" {
+		return
+	}
+	if !util.IsLikelyHTTPURL(url) {
+		// For cases when a non-fully qualified URL is provided
+		url = "https://" + url
+	}
+	if app.S.ArchiveOpenCancel != nil && app.S.ArchiveOpenURL == url {
+		// Such as when moving on to the next chapter again while it's being opened
+		return
+	}
+	app.urlTemplateInferenceCancel()
+	app.archiveOpenCancel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app.S.ArchiveOpenCancel, app.S.ArchiveOpenURL = cancel, url
+	app.notificationShow(fmt.Sprintf("Opening %s…", url), LongNotification)
+	opts := app.archiveOptions(httpReferer)
+	go func() {
+		ar, err := archive.NewArchive(url, opts)
+
+		glib.IdleAdd(func() bool {
+			// Cancelled openings have been superseded
+			if ctx.Err() != nil {
+				if ar != nil {
+					ar.Close()
+				}
+				return false
+			}
+			app.archiveOpenCancel()
+			app.notificationHide()
+
+			if err != nil {
+				app.showError(fmt.Sprintf("Couldn't open %s: %v", url, err))
+				return false
+			}
+			app.doLoadArchive(url, true, httpReferer, ar)
+			if then != nil {
+				then()
+			}
+			return false
+		})
+	}()
+}
+
+// archiveOpenCancel abandons opening the archive being opened in the background, if there is one
+func (app *App) archiveOpenCancel() {
+	if app.S.ArchiveOpenCancel == nil {
+		return
+	}
+	app.S.ArchiveOpenCancel()
+	app.S.ArchiveOpenCancel, app.S.ArchiveOpenURL = nil, ""
 }
 
 func (app *App) loadArchiveFromPath(path string) {
-	app.doLoadArchive(path, false, "")
+	app.doLoadArchive(path, false, "", nil)
 }
 
-func (app *App) doLoadArchive(path string, assumeHTTPURL bool, httpReferer string) {
+// doLoadArchive loads the archive at path, opening it unless it's given already opened
+func (app *App) doLoadArchive(path string, assumeHTTPURL bool, httpReferer string, opened archive.Archive) {
 	if strings.TrimSpace(path) == "" {
 		return
 	}
+	app.urlTemplateInferenceCancel()
+	app.archiveOpenCancel()
 
 	if assumeHTTPURL && !util.IsLikelyHTTPURL(path) {
 		// For cases when a non-fully qualified URL is provided
 		path = "https://" + path
 	}
 
-	if !assumeHTTPURL && !filepath.IsAbs(path) {
-		wd, err := os.Getwd()
-		if err != nil {
-			log.Printf("Error getting current working directory: %v", err)
-			return
+	// When a single image is opened, we load the directory containing it and start at that image
+	startImage := ""
+
+	if !assumeHTTPURL {
+		if !filepath.IsAbs(path) {
+			wd, err := os.Getwd()
+			if err != nil {
+				log.Printf("Error getting current working directory: %v", err)
+				return
+			}
+			path = filepath.Join(wd, path)
+		}
+		path = archive.FirstVolumePath(path)
+		path = archive.FirstNestedVolumePath(path)
+
+		if archive.IsImagePath(path) {
+			if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+				path, startImage = filepath.Split(path)
+				path = filepath.Clean(path)
+			}
 		}
-		path = filepath.Join(wd, path)
 	}
 
+	prepared := app.nextArchiveTake(path)
+
 	if app.archiveIsLoaded() {
 		app.archiveClose()
 	}
@@ -69,28 +147,50 @@ func (app *App) doLoadArchive(path string, assumeHTTPURL bool, httpReferer strin
 	app.S.ImageHashes = make(map[int]imgdiff.Hash)
 
 	app.S.ArchivePath = path
+	app.S.HTTPReferer = httpReferer
+
+	if opened != nil {
+		app.S.Archive = opened
+		app.S.PageCache = pagecache.NewPageCache(app.Config.PageCacheSize)
+	} else if prepared != nil {
+		app.S.Archive, app.S.PageCache = prepared.ar, prepared.cache
+		app.S.PrefetchCancel = prepared.cancel
+	} else {
+		app.S.PageCache = pagecache.NewPageCache(app.Config.PageCacheSize)
 
-	cache := pagecache.NewPageCache()
-	app.S.PageCache = &cache
-	interval := uint(pageCacheTrimInterval.Seconds())
-	handle := glib.TimeoutSecondsAdd(interval, app.trimPageCache)
-	app.S.PageCacheTrimTimeoutHandle = &handle
-
-	var err error
-	if app.S.Archive, err = archive.NewArchive(path, &cache, httpReferer); err != nil {
-		app.showError(fmt.Sprintf("Couldn't open %s: %v", path, err))
-		return
+		var err error
+		if app.S.Archive, err = app.openArchive(path, httpReferer); err != nil {
+			app.showError(fmt.Sprintf("Couldn't open %s: %v", path, err))
+			return
+		}
 	}
 
 	app.archiveHandleLenKnowledge(app.S.Archive.Len() != nil)
+	app.watchArchiveLen()
 
-	app.W.ButtonRightArchive.SetSensitive(!assumeHTTPURL)
-	app.W.ButtonLeftArchive.SetSensitive(!assumeHTTPURL)
+	hasSiblings := !assumeHTTPURL
+	if linked, ok := app.S.Archive.(archive.Linked); ok {
+		hasSiblings = linked.NextURL() != "" || linked.PreviousURL() != ""
+	}
+	app.W.ButtonRightArchive.SetSensitive(hasSiblings)
+	app.W.ButtonLeftArchive.SetSensitive(hasSiblings)
 
 	app.W.MenuItemCopyImageToClipboard.SetSensitive(true)
+	app.W.MenuItemArchiveInfo.SetSensitive(true)
+	_, metadataWritable := app.S.Archive.(archive.MetadataWriter)
+	app.W.MenuItemEditMetadata.SetSensitive(metadataWritable)
+	app.updateForgetPasswordMenuItem()
+	app.applyArchiveMetadata()
+	app.watchArchiveMetadata()
+	app.rebuildChaptersMenu()
+	app.watchArchive()
 
 	if !assumeHTTPURL {
-		err := os.Chdir(filepath.Dir(app.S.ArchivePath))
+		dirPath := filepath.Dir(app.S.ArchivePath)
+		if container, _, ok := archive.SplitNestedPath(app.S.ArchivePath); ok {
+			dirPath = filepath.Dir(container)
+		}
+		err := os.Chdir(dirPath)
 		if err != nil {
 			log.Printf("Could not chdir into archive path: %v", err)
 			return
@@ -105,16 +205,72 @@ func (app *App) doLoadArchive(path string, assumeHTTPURL bool, httpReferer strin
 		}
 	}
 
-	startPage := 0
-	if (!assumeHTTPURL && app.Config.RememberPosition) || (assumeHTTPURL && app.Config.RememberPositionHTTP) {
+	startPage := app.archiveStartPage(path, assumeHTTPURL)
+	if dir, ok := app.S.Archive.(*archive.Dir); ok && startImage != "" {
+		if i := dir.IndexOf(startImage); i != -1 {
+			startPage = i
+		}
+	}
+	app.doSetPage(startPage)
+}
+
+// archiveStartPage returns the page the archive at path is to be opened at
+func (app *App) archiveStartPage(path string, isHTTPURL bool) int {
+	if (!isHTTPURL && app.Config.RememberPosition) || (isHTTPURL && app.Config.RememberPositionHTTP) {
 		savedArchivePos, err := app.loadReadingPosition(path)
 		if err == nil {
-			startPage = savedArchivePos
+			return savedArchivePos
 		} else if !os.IsNotExist(err) {
 			log.Printf("Error loading reading position: %v", err)
 		}
 	}
-	app.doSetPage(startPage)
+	return 0
+}
+
+// openArchive opens the archive at path, prompting for the password if it's encrypted and there
+// isn't a correct one saved
+func (app *App) openArchive(path string, httpReferer string) (archive.Archive, error) {
+	opts := app.archiveOptions(httpReferer)
+	savedPassword, hasSavedPassword := app.loadSavedPassword(path)
+	if hasSavedPassword {
+		opts.Password = savedPassword
+	}
+
+	remember := false
+	for {
+		ar, err := archive.NewArchive(path, opts)
+		if err == nil {
+			if remember {
+				app.savePassword(path, opts.Password)
+			}
+			return ar, nil
+		}
+
+		badPassword := errors.Is(err, archive.ErrBadPassword)
+		if !badPassword && !errors.Is(err, archive.ErrPasswordRequired) {
+			return nil, err
+		}
+		if badPassword && hasSavedPassword && opts.Password == savedPassword {
+			app.forgetPassword(path)
+		}
+
+		var ok bool
+		opts.Password, remember, ok = app.passwordDialogRun(filepath.Base(path), badPassword)
+		if !ok {
+			return nil, err
+		}
+	}
+}
+
+// archiveOptions returns the options archives are opened with, save for the password
+func (app *App) archiveOptions(httpReferer string) archive.Options {
+	return archive.Options{
+		HTTPReferer:     httpReferer,
+		HTTPCache:       app.S.HTTPCache,
+		HTTPProbeLength: app.Config.HTTPProbeLength,
+		HTTPProfiles:    app.Config.HTTPProfiles,
+		RecursiveDir:    app.Config.RecursiveDir || app.S.RecursiveDirForced,
+	}
 }
 
 func (app *App) archiveIsLoaded() bool {
@@ -141,29 +297,39 @@ func (app *App) archiveClose() {
 
 	app.maybeSaveReadingPosition()
 
+	app.pageLoadCancel()
+	app.prefetchCancel()
+	app.nextArchiveDiscard()
+	app.S.PrefetchPos = 0
 	app.S.Archive.Close()
 
 	app.S.ArchivePath = ""
 	app.S.ArchivePos = 0
 
+	stats := app.S.PageCache.Stats()
+	log.Printf("Page cache: %d hits, %d misses, %d evictions", stats.Hits, stats.Misses, stats.Evictions)
 	app.S.PageCache = nil
 
 	app.S.ImageHashes = nil
 
 	app.clearJumpmarks()
 
-	// Cancel page cache trim timeout
-	if app.S.PageCacheTrimTimeoutHandle != nil {
-		glib.SourceRemove(*app.S.PageCacheTrimTimeoutHandle)
-		app.S.PageCacheTrimTimeoutHandle = nil
+	if app.S.MangaModeForced {
+		app.forceMangaMode(false)
 	}
 
+	app.animationsStop()
 	app.W.ImageL.Clear()
 	app.W.ImageR.Clear()
+	app.W.PagePlaceholder.Hide()
 	app.S.PixbufL = nil
 	app.S.PixbufR = nil
 	app.S.Cursor.reset()
 	app.W.MenuItemCopyImageToClipboard.SetSensitive(false)
+	app.W.MenuItemForgetPassword.SetSensitive(false)
+	app.W.MenuItemArchiveInfo.SetSensitive(false)
+	app.W.MenuItemEditMetadata.SetSensitive(false)
+	app.rebuildChaptersMenu()
 	app.setStatus("")
 	app.W.MainWindow.SetTitle(AppNameDisplay)
 
@@ -192,7 +358,7 @@ func (app *App) maybeLoadArchiveFromClipboardURL() {
 			log.Panicf("getting clipboard text: %v", err)
 		} else {
 			if util.IsLikelyHTTPURL(text) {
-				app.loadArchiveFromURL(text, "")
+				app.openURL(text, "")
 			}
 		}
 	}
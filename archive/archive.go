@@ -19,22 +19,25 @@
 package archive
 
 import (
+	"context"
 	"errors"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"github.com/fauu/gomicsv/pagecache"
+	"github.com/fauu/gomicsv/httpcache"
 	"github.com/fauu/gomicsv/util"
-	"github.com/gotk3/gotk3/gdk"
 )
 
 var (
-	ErrBounds = errors.New("Image index out of bounds.")
+	ErrBounds           = errors.New("Image index out of bounds.")
+	ErrPasswordRequired = errors.New("Password required")
+	ErrBadPassword      = errors.New("Incorrect password")
+	ErrPageRemoved      = errors.New("The page has been removed")
 )
 
 type Archive interface {
-	Load(i int, autorotate bool, nPreload int) (*gdk.Pixbuf, error)
+	Load(ctx context.Context, i int, nPreload int) (*Page, error) // Gives up once ctx is done
 	Kind() Kind
 	ArchiveName() string
 	Name(i int) (string, error)
@@ -46,27 +49,149 @@ const (
 	MaxArchiveEntries = 4096 * 64
 )
 
-func NewArchive(path string, pageCache *pagecache.PageCache, httpReferer string) (Archive, error) {
+// Chapter is a named section of an archive beginning at page Start
+type Chapter struct {
+	Title string
+	Start int
+}
+
+// Chaptered is implemented by archives that can know how their pages are divided into chapters
+type Chaptered interface {
+	Chapters() []Chapter // Ordered by the starting pages. Empty if the division is unknown
+}
+
+// ChapterAt returns the chapter that page i belongs to, or nil if it precedes all the chapters.
+// The chapters must be ordered by their starting pages
+func ChapterAt(chapters []Chapter, i int) *Chapter {
+	if idx := ChapterIndexAt(chapters, i); idx != -1 {
+		return &chapters[idx]
+	}
+	return nil
+}
+
+// LenDiscoverer is implemented by archives whose length can become known while they are open
+type LenDiscoverer interface {
+	// OnLenKnown sets the function to call, possibly from another goroutine, once Len is no longer
+	// nil. It is called right away if that's already the case
+	OnLenKnown(notify func())
+}
+
+// Linked is implemented by archives that can know where the neighboring archives are, such as the
+// chapters of a comic on a website
+type Linked interface {
+	NextURL() string     // Empty if unknown
+	PreviousURL() string // Empty if unknown
+}
+
+// Watchable is implemented by archives whose contents can change while they are open
+type Watchable interface {
+	// Watch starts watching for changes, calling notify from another goroutine whenever there are
+	// some pending
+	Watch(notify func()) error
+	// Sync applies the pending changes, returning those that affected the pages in the order they
+	// were applied. Empty if there were none
+	Sync() []IndexChange
+}
+
+// IndexChange is a page that has been inserted into an archive, removed from it or modified. Each
+// index refers to the pages as they were after the preceding changes
+type IndexChange struct {
+	Index int
+	Type  IndexChangeType
+}
+
+type IndexChangeType int
+
+const (
+	PageInserted IndexChangeType = iota
+	PageRemoved
+	PageModified
+)
+
+// MapIndex returns the index that the page at index i has after the changes. ok is false if the
+// page has been removed or modified
+func MapIndex(i int, changes []IndexChange) (j int, ok bool) {
+	for _, c := range changes {
+		switch c.Type {
+		case PageInserted:
+			if i >= c.Index {
+				i++
+			}
+		case PageRemoved:
+			if i == c.Index {
+				return 0, false
+			}
+			if i > c.Index {
+				i--
+			}
+		case PageModified:
+			if i == c.Index {
+				return 0, false
+			}
+		}
+	}
+	return i, true
+}
+
+type Options struct {
+	HTTPReferer     string
+	HTTPCache       *httpcache.HTTPCache // Used for HTTP archives if not nil
+	HTTPProbeLength bool                 // Whether to look for the length of HTTP archives
+	HTTPProfiles    []HTTPProfile        // The first one matching the URL of an HTTP archive is used
+	Password        string               // Used for encrypted archives. ErrPasswordRequired is returned if needed but empty
+	RecursiveDir    bool                 // Whether a directory is opened together with its subdirectories
+}
+
+func NewArchive(path string, opts Options) (Archive, error) {
 	if util.IsLikelyHTTPURL(path) {
-		return NewHTTP(path, pageCache, httpReferer)
+		if IsHTTPGalleryURL(path, opts) {
+			return NewHTTPGallery(path, opts)
+		}
+		return NewHTTP(path, opts)
+	}
+
+	if container, inner, ok := SplitNestedPath(path); ok {
+		return NewNested(container, inner, opts.Password)
 	}
 
+	path = FirstVolumePath(path)
+
 	f, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
 
 	if f.IsDir() {
-		return NewDir(path)
+		return NewDir(path, opts.RecursiveDir)
+	}
+
+	if IsImagePath(path) {
+		// A single image stands for the directory containing it
+		return NewDir(filepath.Dir(path), opts.RecursiveDir)
 	}
 
 	ext := strings.ToLower(filepath.Ext(path))[1:]
 	switch ext {
 	case "zip", "cbz":
-		return NewZip(path)
-	case "rar":
-		return NewRar(path)
-	case "7z", "tar", "tgz", "gz", "tbz2", "cb7", "cbr", "cbt", "lha":
+		return NewZip(path, opts.Password)
+	case "rar", "cbr":
+		return NewRar(path, opts.Password)
+	case "epub":
+		return NewEPUB(path)
+	case "7z", "cb7":
+		return NewSevenZip(path, opts.Password)
+	case "001":
+		if isSevenZipVolume(path) {
+			return NewSevenZip(path, opts.Password)
+		}
+	case "tar", "cbt", "tgz", "tbz", "tbz2", "txz":
+		return NewTar(path)
+	case "gz", "bz2", "xz":
+		if strings.HasSuffix(strings.ToLower(path), ".tar."+ext) {
+			return NewTar(path)
+		}
+		return nil, errors.New("Archive type not supported, please unpack it first")
+	case "lha":
 		return nil, errors.New("Archive type not supported, please unpack it first")
 	}
 
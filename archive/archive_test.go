@@ -0,0 +1,937 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fauu/gomicsv/httpcache"
+	"github.com/ulikunitz/xz"
+	yzip "github.com/yeka/zip"
+)
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// checkPages verifies that ar consists of the given pages, each a PNG as wide as its index + 1
+func checkPages(t *testing.T, ar Archive, names []string) {
+	t.Helper()
+	if l := ar.Len(); l == nil {
+		t.Fatalf("Len() = nil, want %d", len(names))
+	} else if *l != len(names) {
+		t.Fatalf("Len() = %d, want %d", *l, len(names))
+	}
+	for i, want := range names {
+		name, err := ar.Name(i)
+		if err != nil || name != want {
+			t.Errorf("Name(%d) = %q, %v, want %q", i, name, err, want)
+		}
+		page, err := ar.Load(context.Background(), i, 0)
+		if err != nil {
+			t.Fatalf("Load(%d): %v", i, err)
+		}
+		if page.MIMEType != "image/png" {
+			t.Errorf("page %d: MIMEType = %q, want image/png", i, page.MIMEType)
+		}
+		config, err := page.DecodeConfig()
+		if err != nil || config.Width != i+1 {
+			t.Errorf("page %d: width = %d, %v, want %d", i, config.Width, err, i+1)
+		}
+	}
+	if _, err := ar.Load(context.Background(), len(names), 0); err != ErrBounds {
+		t.Errorf("Load past the end: %v, want ErrBounds", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ar.Load(ctx, 0, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("Load with a cancelled context: %v, want context.Canceled", err)
+	}
+}
+
+func TestZip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	for name, data := range map[string][]byte{
+		"10.png":        testPNG(t, 2, 1),
+		"2.png":         testPNG(t, 1, 1),
+		"notes.txt":     []byte("Not an image"),
+		"ComicInfo.xml": []byte("<ComicInfo><Series>Test</Series></ComicInfo>"),
+	} {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	ar, err := NewZip(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ar.Close()
+
+	checkPages(t, ar, []string{"2.png", "10.png"})
+	if ci := ar.Metadata(); ci == nil || ci.Series != "Test" {
+		t.Errorf("Metadata() = %+v, want the series Test", ci)
+	}
+}
+
+func TestZipEncrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := yzip.NewWriter(f)
+	for name, data := range map[string][]byte{
+		"1.png": testPNG(t, 1, 1),
+		"2.png": testPNG(t, 2, 1),
+	} {
+		fw, err := w.Encrypt(name, "secret", yzip.AES256Encryption)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	for _, tc := range []struct {
+		password string
+		err      error
+	}{
+		{"", ErrPasswordRequired},
+		{"wrong", ErrBadPassword},
+	} {
+		if _, err := NewZip(path, tc.password); !errors.Is(err, tc.err) {
+			t.Errorf("NewZip(%q) error = %v, want %v", tc.password, err, tc.err)
+		}
+	}
+
+	ar, err := NewZip(path, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ar.Close()
+
+	checkPages(t, ar, []string{"1.png", "2.png"})
+}
+
+func TestRar(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		password string
+		solid    bool
+	}{
+		{"test.cbr", "", false},
+		{"solid.cbr", "", true},
+		{"encrypted.cbr", "secret", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ar, err := NewRar(filepath.Join("testdata", tc.name), tc.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ar.Close()
+
+			if ar.solid != tc.solid {
+				t.Errorf("solid = %v, want %v", ar.solid, tc.solid)
+			}
+			checkPages(t, ar, []string{"1.png", "2.png", "10.png"})
+			if _, err := ar.Name(3); err != ErrBounds {
+				t.Errorf("Name past the end: %v, want ErrBounds", err)
+			}
+
+			if err := ar.Close(); err != nil {
+				t.Errorf("Close(): %v", err)
+			}
+		})
+	}
+}
+
+func TestRarSolidMetadata(t *testing.T) {
+	ar, err := NewRar(filepath.Join("testdata", "solid.cbr"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ar.Close()
+
+	// ComicInfo.xml follows the images, so it's only read by the extraction
+	known := make(chan struct{})
+	ar.OnMetadataKnown(func() { close(known) })
+	select {
+	case <-known:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the metadata didn't become known")
+	}
+	if ci := ar.Metadata(); ci == nil || ci.Series != "Solid" {
+		t.Errorf("Metadata() = %+v, want the series Solid", ci)
+	}
+}
+
+func TestRarEncrypted(t *testing.T) {
+	path := filepath.Join("testdata", "encrypted.cbr")
+	for _, tc := range []struct {
+		password string
+		err      error
+	}{
+		{"", ErrPasswordRequired},
+		{"wrong", ErrBadPassword},
+	} {
+		if _, err := NewRar(path, tc.password); !errors.Is(err, tc.err) {
+			t.Errorf("NewRar(%q) error = %v, want %v", tc.password, err, tc.err)
+		}
+	}
+}
+
+func TestSevenZip(t *testing.T) {
+	ar, err := NewSevenZip(filepath.Join("testdata", "test.cb7"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ar.Close()
+
+	if ar.Kind() != Packed {
+		t.Errorf("Kind() = %v, want Packed", ar.Kind())
+	}
+	checkPages(t, ar, []string{"1.png", "2.png", "10.png"})
+	if _, err := ar.Name(3); err != ErrBounds {
+		t.Errorf("Name past the end: %v, want ErrBounds", err)
+	}
+}
+
+func TestTar(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		compress func(w io.Writer) (io.WriteCloser, error)
+	}{
+		{"test.cbt", nil},
+		{"test.tar.gz", func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }},
+		{"test.tar.xz", func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.name)
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var w io.WriteCloser = f
+			if tc.compress != nil {
+				if w, err = tc.compress(f); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tw := tar.NewWriter(w)
+			for _, file := range []struct {
+				name string
+				data []byte
+			}{
+				{"10.png", testPNG(t, 3, 1)},
+				{"dir/", nil},
+				{"2.png", testPNG(t, 2, 1)},
+				{"notes.txt", []byte("Not an image")},
+				{"1.png", testPNG(t, 1, 1)},
+			} {
+				header := &tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.data)), Typeflag: tar.TypeReg}
+				if strings.HasSuffix(file.name, "/") {
+					header.Typeflag = tar.TypeDir
+				}
+				if err := tw.WriteHeader(header); err != nil {
+					t.Fatal(err)
+				}
+				tw.Write(file.data)
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+
+			ar, err := NewTar(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ar.Close()
+
+			checkPages(t, ar, []string{"1.png", "2.png", "10.png"})
+			if _, err := ar.Name(3); err != ErrBounds {
+				t.Errorf("Name past the end: %v, want ErrBounds", err)
+			}
+		})
+	}
+}
+
+func TestNested(t *testing.T) {
+	inner := func(pages map[string][]byte) []byte {
+		var buf bytes.Buffer
+		w := zip.NewWriter(&buf)
+		for name, data := range pages {
+			fw, err := w.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw.Write(data)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	volume := inner(map[string][]byte{
+		"10.png":    testPNG(t, 3, 1),
+		"2.png":     testPNG(t, 2, 1),
+		"1.png":     testPNG(t, 1, 1),
+		"notes.txt": []byte("Not an image"),
+	})
+
+	container := filepath.Join(t.TempDir(), "Series.zip")
+	f, err := os.Create(container)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	// Stored volumes are read straight from the container, deflated ones from memory
+	for _, file := range []struct {
+		name   string
+		method uint16
+		data   []byte
+	}{
+		{"Series v10.cbz", zip.Deflate, volume},
+		{"Series v2.cbz", zip.Store, volume},
+		{"notes.txt", zip.Deflate, []byte("Not an archive")},
+	} {
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: file.name, Method: file.method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(file.data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	names, err := ListNested(container)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Series v2.cbz", "Series v10.cbz"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("ListNested() = %q, want %q", names, want)
+	}
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			gotContainer, gotInner, ok := SplitNestedPath(filepath.Join(container, name))
+			if !ok || gotContainer != container || gotInner != name {
+				t.Errorf("SplitNestedPath() = %q, %q, %v", gotContainer, gotInner, ok)
+			}
+
+			ar, err := NewNested(container, name, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ar.Close()
+
+			if ar.ArchiveName() != name {
+				t.Errorf("ArchiveName() = %q, want %q", ar.ArchiveName(), name)
+			}
+			checkPages(t, ar, []string{"1.png", "2.png", "10.png"})
+			if _, err := ar.Name(3); err != ErrBounds {
+				t.Errorf("Name past the end: %v, want ErrBounds", err)
+			}
+		})
+	}
+
+	if _, err := NewNested(container, "Series v3.cbz", ""); err == nil {
+		t.Error("NewNested() of a missing volume succeeded")
+	}
+}
+
+func TestEPUB(t *testing.T) {
+	// The images are named out of reading order and the table of contents
+	// lists the chapters backwards; the spine and page numbers must win.
+	ar, err := NewEPUB(filepath.Join("testdata", "test.epub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ar.Close()
+
+	checkPages(t, ar, []string{"OEBPS/images/z.png", "OEBPS/images/a.png", "OEBPS/images/m.png"})
+	if _, err := ar.Name(3); err != ErrBounds {
+		t.Errorf("Name past the end: %v, want ErrBounds", err)
+	}
+	want := []Chapter{{"Chapter 1", 0}, {"Chapter 2", 2}}
+	if got := ar.Chapters(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Chapters() = %v, want %v", got, want)
+	}
+}
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"b/1.png":   testPNG(t, 3, 1),
+		"a/2.png":   testPNG(t, 2, 1),
+		"a/1.png":   testPNG(t, 1, 1),
+		"notes.txt": []byte("Not an image"),
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ar, err := NewDir(filepath.Join(dir, "a"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPages(t, ar, []string{"1.png", "2.png"})
+
+	ar, err = NewDir(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPages(t, ar, []string{filepath.Join("a", "1.png"), filepath.Join("a", "2.png"), filepath.Join("b", "1.png")})
+
+	os.Remove(filepath.Join(dir, "b", "1.png"))
+	if _, err := ar.Load(context.Background(), 2, 0); !errors.Is(err, ErrPageRemoved) {
+		t.Errorf("Load of a removed page: %v, want ErrPageRemoved", err)
+	}
+	if changes := ar.Sync(); !reflect.DeepEqual(changes, []IndexChange{{2, PageRemoved}}) || *ar.Len() != 2 {
+		t.Errorf("Sync() = %v, the removed page should be gone", changes)
+	}
+
+	// As the watcher would report them
+	ar.queueChanges([]dirChange{
+		{name: filepath.Join("a", "0.png")},
+		{name: filepath.Join("a", "2.png")},
+		{name: "a", removed: true, dir: true},
+		{name: "notes.txt"},
+	})
+	want := []IndexChange{{0, PageInserted}, {2, PageModified}, {0, PageRemoved}, {0, PageRemoved}, {0, PageRemoved}}
+	if changes := ar.Sync(); !reflect.DeepEqual(changes, want) {
+		t.Errorf("Sync() = %v, want %v", changes, want)
+	}
+	if changes := ar.Sync(); len(changes) != 0 {
+		t.Errorf("Sync() without pending changes = %v", changes)
+	}
+}
+
+func TestMapIndex(t *testing.T) {
+	changes := []IndexChange{{1, PageInserted}, {3, PageRemoved}, {0, PageModified}}
+	for _, tc := range []struct {
+		i, j int
+		ok   bool
+	}{
+		{0, 0, false}, // Modified
+		{1, 2, true},
+		{2, 0, false}, // Shifted to 3 and removed
+		{3, 3, true},
+	} {
+		if j, ok := MapIndex(tc.i, changes); j != tc.j || ok != tc.ok {
+			t.Errorf("MapIndex(%d) = %d, %v, want %d, %v", tc.i, j, ok, tc.j, tc.ok)
+		}
+	}
+}
+
+func TestListInDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"a.cbz", "b.tar.gz", "c.TAR.BZ2", "d.tar.xz", "e.gz", "notes.txt", ".tar.gz",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names, err := ListInDirectory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.cbz", "b.tar.gz", "c.TAR.BZ2", "d.tar.xz"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListInDirectory = %q, want %q", names, want)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	// The pages start at 1, and page 1 is as wide as 1 (its index in the archive is 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		if _, err := fmt.Sscanf(r.URL.Path, "/page/%d.png", &n); err != nil || n < 1 || n > 3 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(testPNG(t, n, 1))
+	}))
+	defer server.Close()
+
+	ar, err := NewHTTP(server.URL+"/page/%d.png", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ar.Close()
+
+	for i := 0; i < 3; i++ {
+		page, err := ar.Load(context.Background(), i, 0)
+		if err != nil {
+			t.Fatalf("Load(%d): %v", i, err)
+		}
+		if config, err := page.DecodeConfig(); err != nil || config.Width != i+1 {
+			t.Errorf("page %d: width = %d, %v, want %d", i, config.Width, err, i+1)
+		}
+		if name, err := ar.Name(i); err != nil || name != fmt.Sprintf("%s/page/%d.png", server.URL, i+1) {
+			t.Errorf("Name(%d) = %q, %v", i, name, err)
+		}
+	}
+	if _, err := ar.Load(context.Background(), 3, 0); !errors.Is(err, ErrBounds) {
+		t.Errorf("Load past the last page: %v, want ErrBounds", err)
+	}
+	if _, err := ar.Name(3); err != ErrBounds {
+		t.Errorf("Name past the last page: %v, want ErrBounds", err)
+	}
+	if l := ar.Len(); l == nil {
+		t.Errorf("Len() = nil, want 3")
+	} else if *l != 3 {
+		t.Errorf("Len() = %d, want 3", *l)
+	}
+}
+
+func TestHTTPProbeLength(t *testing.T) {
+	const length = 37
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		if _, err := fmt.Sscanf(r.URL.Path, "/%d.png", &n); err != nil || n < 0 || n >= length {
+			http.Error(w, "Gone", http.StatusGone)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(testPNG(t, 1, 1))
+	}))
+	defer server.Close()
+
+	ar, err := NewHTTP(server.URL+"/%d.png", Options{HTTPProbeLength: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ar.Close()
+	known := make(chan struct{})
+	ar.OnLenKnown(func() { close(known) })
+	select {
+	case <-known:
+	case <-time.After(5 * time.Second):
+		t.Fatal("length not found")
+	}
+	if l := ar.Len(); l == nil {
+		t.Errorf("Len() = nil, want %d", length)
+	} else if *l != length {
+		t.Errorf("Len() = %d, want %d", *l, length)
+	}
+}
+
+func TestHTTPCached(t *testing.T) {
+	var fullResponses int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		if _, err := fmt.Sscanf(r.URL.Path, "/page/%d.png", &n); err != nil || n < 1 || n > 2 {
+			http.NotFound(w, r)
+			return
+		}
+		etag := fmt.Sprintf(`"%d"`, n)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fullResponses++
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(testPNG(t, n, 1))
+	}))
+	defer server.Close()
+
+	cache, err := httpcache.NewHTTPCache(t.TempDir(), 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second time around, the pages are only revalidated
+	for run := 0; run < 2; run++ {
+		ar, err := NewHTTP(server.URL+"/page/%d.png", Options{HTTPCache: cache})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			page, err := ar.Load(context.Background(), i, 0)
+			if err != nil {
+				t.Fatalf("run %d: Load(%d): %v", run, i, err)
+			}
+			if config, err := page.DecodeConfig(); err != nil || config.Width != i+1 {
+				t.Errorf("run %d: page %d: width = %d, %v, want %d", run, i, config.Width, err, i+1)
+			}
+		}
+	}
+	if fullResponses != 2 {
+		t.Errorf("%d full responses, want 2", fullResponses)
+	}
+}
+
+func TestHTTPFetching(t *testing.T) {
+	var mutex sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.URL.Path]++
+		n := requests[r.URL.Path]
+		mutex.Unlock()
+		// Page 2 fails at first
+		if r.URL.Path == "/2.png" && n == 1 {
+			http.Error(w, "Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(testPNG(t, 1, 1))
+	}))
+	defer server.Close()
+
+	ar, err := NewHTTP(server.URL+"/%d.png", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ar.Close()
+
+	// Simultaneous loads of a page share the download
+	var wg sync.WaitGroup
+	for k := 0; k < 3; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ar.Load(context.Background(), 1, 0); err != nil {
+				t.Errorf("Load(1): %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	mutex.Lock()
+	n := requests["/1.png"]
+	mutex.Unlock()
+	if n != 1 {
+		t.Errorf("page 1 requested %d times, want 1", n)
+	}
+
+	if _, err := ar.Load(context.Background(), 2, 0); err != nil {
+		t.Errorf("Load(2) not retried: %v", err)
+	}
+}
+
+func TestHTTPProfile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("session")
+		_, consentErr := r.Cookie("consent")
+		if r.UserAgent() != "test" || r.Header.Get("X-Token") != "secret" || r.Referer() != "http://referer/" ||
+			err != nil || cookie.Value != "abc" || consentErr != nil {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(testPNG(t, 1, 1))
+	}))
+	defer server.Close()
+
+	cookiesFile := filepath.Join(t.TempDir(), "cookies.txt")
+	cookies := "# Netscape HTTP Cookie File\n" +
+		"#HttpOnly_127.0.0.1\tFALSE\t/\tFALSE\t0\tsession\tabc\r\n" +
+		"127.0.0.1\tFALSE\t/\tFALSE\t1\texpired\txyz\n" +
+		"127.0.0.1\tFALSE\t/\tFALSE\t0\tconsent\t\n" +
+		"127.0.0.1\tFALSE\t/\tFALSE\tnever\tmalformed\txyz\n" +
+		"malformed\n"
+	if err := os.WriteFile(cookiesFile, []byte(cookies), 0600); err != nil {
+		t.Fatal(err)
+	}
+	profiles := []HTTPProfile{
+		{Name: "other", Hosts: []string{"*.example.com"}},
+		{
+			Name:        "test",
+			URLPattern:  `^http://127\.0\.0\.1:\d+/`,
+			Headers:     map[string]string{"X-Token": "secret"},
+			Referer:     "http://referer/",
+			UserAgent:   "test",
+			CookiesFile: cookiesFile,
+		},
+	}
+
+	for url, want := range map[string]string{
+		"http://example.com/1.png":   "other",
+		"http://a.example.com/1.png": "other",
+		server.URL + "/1.png":        "test",
+		"http://example.org/1.png":   "",
+	} {
+		p, err := MatchHTTPProfile(profiles, url)
+		got := ""
+		if p != nil {
+			got = p.Name
+		}
+		if err != nil || got != want {
+			t.Errorf("MatchHTTPProfile(%q) = %q, %v, want %q", url, got, err, want)
+		}
+	}
+
+	ar, err := NewHTTP(server.URL+"/%d.png", Options{HTTPProfiles: profiles})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ar.Close()
+	if _, err := ar.Load(context.Background(), 0, 0); err != nil {
+		t.Errorf("Load(0): %v", err)
+	}
+}
+
+func TestGuessURLTemplates(t *testing.T) {
+	for url, want := range map[string][]string{
+		"http://host:8080/c/12/0007.webp": {"http://host:8080/c/12/%04d.webp", "http://host:8080/c/%d/0007.webp"},
+		"http://host/read?id=5&page=10&w=800": {
+			"http://host/read?id=5&page=%d&w=800", "http://host/read?id=5&page=10&w=%d", "http://host/read?id=%d&page=10&w=800",
+		},
+		"http://host/a%20b/p3.png#1234567": {"http://host/a%%20b/p%d.png#1234567"},
+		"http://host/1234567.png":          nil,
+	} {
+		var got []string
+		for _, g := range guessURLTemplates(url) {
+			got = append(got, g.template)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("guessURLTemplates(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
+
+func TestInferURLTemplates(t *testing.T) {
+	// Chapters 1234 and 1235 have pages 1 to 9, the width of which is their number. The w parameter
+	// changes nothing
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var chapter, n int
+		if _, err := fmt.Sscanf(r.URL.Path, "/c/%d/%04d.png", &chapter, &n); err != nil ||
+			chapter < 1234 || chapter > 1235 || n < 1 || n > 9 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(testPNG(t, n, chapter-1233))
+	}))
+	defer server.Close()
+
+	candidates, err := InferURLTemplates(context.Background(), server.URL+"/c/1234/0007.png?w=800", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []URLTemplateCandidate{
+		{Template: server.URL + "/c/1234/%04d.png?w=800", Verified: true},
+		{Template: server.URL + "/c/%d/0007.png?w=800", Verified: true},
+	}
+	if !reflect.DeepEqual(candidates, want) {
+		t.Errorf("InferURLTemplates = %v, want %v", candidates, want)
+	}
+
+	ar, err := NewHTTP(server.URL+"/c/1234/0009.png", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ar.Close()
+	if name := ar.ArchiveName(); name != server.URL+"/c/1234/%04d.png" {
+		t.Errorf("ArchiveName() = %q", name)
+	}
+	page, err := ar.Load(context.Background(), 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config, err := page.DecodeConfig(); err != nil || config.Width != 2 {
+		t.Errorf("page 1: width = %d, %v, want 2", config.Width, err)
+	}
+}
+
+func TestHTTPGallery(t *testing.T) {
+	const chapter = `<html><body>
+<a class="nav" href="/chapter/1">Previous</a> <a class="nav next" href="3">Next</a>
+<div id="pages">
+  <img class="page" src="/img/1.png">
+  <img class="page" src="data:image/gif;base64,R0lGOD" data-src="/img/2.png">
+  <img class="page" src="/img/1.png">
+</div>
+<script>var pages = ["\/img\/1.png", "\/img\/2.png"];</script>
+</body></html>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chapter/2" {
+			w.Write([]byte(chapter))
+			return
+		}
+		var n int
+		if _, err := fmt.Sscanf(r.URL.Path, "/img/%d.png", &n); err != nil || n < 1 || n > 2 {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Referer() != "http://"+r.Host+"/chapter/2" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(testPNG(t, n, 1))
+	}))
+	defer server.Close()
+
+	want := &Gallery{
+		ImageURLs:   []string{server.URL + "/img/1.png", server.URL + "/img/2.png"},
+		NextURL:     server.URL + "/chapter/3",
+		PreviousURL: server.URL + "/chapter/1",
+	}
+	for _, rule := range []GalleryRule{
+		{Images: "#pages img.page", ImageAttrs: "data-src src", Next: "a.next", Previous: "a.nav"},
+		{ImagesPattern: `"(\\/img\\/\d+\.png)"`, NextPattern: `href="(\d+)"`, PreviousPattern: `/chapter/\d+`},
+	} {
+		gallery, err := ScrapeGallery([]byte(chapter), server.URL+"/chapter/2", rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(gallery, want) {
+			t.Errorf("ScrapeGallery(%+v) = %+v, want %+v", rule, gallery, want)
+		}
+	}
+	if _, err := ScrapeGallery([]byte(chapter), server.URL, GalleryRule{Images: "img["}); err == nil {
+		t.Error("ScrapeGallery with an invalid selector succeeded")
+	}
+
+	opts := Options{HTTPProfiles: []HTTPProfile{{
+		Name:    "gallery",
+		Hosts:   []string{"127.0.0.1"},
+		Gallery: &GalleryRule{Images: "img.page", ImageAttrs: "data-src src", Next: "a.next"},
+	}}}
+	ar, err := NewArchive(server.URL+"/chapter/2", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ar.Close()
+	if l := ar.Len(); l == nil {
+		t.Errorf("Len() = nil, want 2")
+	} else if *l != 2 {
+		t.Errorf("Len() = %d, want 2", *l)
+	}
+	for i := 0; i < 2; i++ {
+		page, err := ar.Load(context.Background(), i, 1)
+		if err != nil {
+			t.Fatalf("Load(%d): %v", i, err)
+		}
+		if config, err := page.DecodeConfig(); err != nil || config.Width != i+1 {
+			t.Errorf("page %d: width = %d, %v, want %d", i, config.Width, err, i+1)
+		}
+		if name, err := ar.Name(i); err != nil || name != want.ImageURLs[i] {
+			t.Errorf("Name(%d) = %q, %v, want %q", i, name, err, want.ImageURLs[i])
+		}
+	}
+	for _, i := range []int{-1, 2} {
+		if _, err := ar.Name(i); err != ErrBounds {
+			t.Errorf("Name(%d): %v, want ErrBounds", i, err)
+		}
+	}
+	if linked := ar.(Linked); linked.NextURL() != want.NextURL || linked.PreviousURL() != "" {
+		t.Errorf("NextURL() = %q, PreviousURL() = %q", linked.NextURL(), linked.PreviousURL())
+	}
+
+	// Images on the same site are still opened directly
+	opts.HTTPReferer = server.URL + "/chapter/2"
+	if ar, err := NewArchive(server.URL+"/img/1.png", opts); err != nil {
+		t.Error(err)
+	} else {
+		ar.Close()
+	}
+}
+
+func TestVolumes(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.part1.rar", "a.part2.rar", "b.part01.rar", "b.part02.rar", "c.rar", "c.r00", "d.7z.001", "d.7z.002"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name       string
+		first      string
+		subsequent bool
+		sevenZip   bool
+	}{
+		{"a.part1.rar", "a.part1.rar", false, false},
+		{"a.part2.rar", "a.part1.rar", true, false},
+		{"b.part02.rar", "b.part01.rar", true, false},
+		{"c.rar", "c.rar", false, false},
+		{"c.r00", "c.rar", false, false},
+		{"d.7z.001", "d.7z.001", false, true},
+		{"d.7z.002", "d.7z.001", true, true},
+		{"e.part2.rar", "e.part2.rar", true, false}, // First volume missing
+		{"f.cbz", "f.cbz", false, false},
+	} {
+		path := filepath.Join(dir, tc.name)
+		if got, want := FirstVolumePath(path), filepath.Join(dir, tc.first); got != want {
+			t.Errorf("FirstVolumePath(%q) = %q, want %q", tc.name, got, want)
+		}
+		if got := isSubsequentVolume(tc.name); got != tc.subsequent {
+			t.Errorf("isSubsequentVolume(%q) = %v, want %v", tc.name, got, tc.subsequent)
+		}
+		if got := isSevenZipVolume(path); got != tc.sevenZip {
+			t.Errorf("isSevenZipVolume(%q) = %v, want %v", tc.name, got, tc.sevenZip)
+		}
+	}
+}
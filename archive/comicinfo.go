@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package archive
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"path"
+	"strings"
+)
+
+const ComicInfoFilename = "ComicInfo.xml"
+
+// Values of ComicInfo.Manga
+const (
+	MangaUnknown           = "Unknown"
+	MangaNo                = "No"
+	MangaYes               = "Yes"
+	MangaYesAndRightToLeft = "YesAndRightToLeft"
+)
+
+// Values of ComicInfoPage.Type
+const (
+	PageTypeFrontCover    = "FrontCover"
+	PageTypeInnerCover    = "InnerCover"
+	PageTypeRoundup       = "Roundup"
+	PageTypeStory         = "Story"
+	PageTypeAdvertisement = "Advertisement"
+	PageTypeEditorial     = "Editorial"
+	PageTypeLetters       = "Letters"
+	PageTypePreview       = "Preview"
+	PageTypeBackCover     = "BackCover"
+	PageTypeOther         = "Other"
+	PageTypeDeleted       = "Deleted"
+)
+
+// ComicInfo is the metadata from a ComicInfo.xml file, as defined by the ComicRack schema. Numeric
+// fields are kept as strings, since they are often filled in carelessly
+type ComicInfo struct {
+	XMLName     xml.Name           `xml:"ComicInfo"`
+	Title       string             `xml:",omitempty"`
+	Series      string             `xml:",omitempty"`
+	Number      string             `xml:",omitempty"`
+	Count       string             `xml:",omitempty"`
+	Volume      string             `xml:",omitempty"`
+	Summary     string             `xml:",omitempty"`
+	Year        string             `xml:",omitempty"`
+	Month       string             `xml:",omitempty"`
+	Day         string             `xml:",omitempty"`
+	Writer      string             `xml:",omitempty"`
+	Penciller   string             `xml:",omitempty"`
+	Inker       string             `xml:",omitempty"`
+	Colorist    string             `xml:",omitempty"`
+	Letterer    string             `xml:",omitempty"`
+	CoverArtist string             `xml:",omitempty"`
+	Editor      string             `xml:",omitempty"`
+	Publisher   string             `xml:",omitempty"`
+	Genre       string             `xml:",omitempty"`
+	Web         string             `xml:",omitempty"`
+	LanguageISO string             `xml:",omitempty"`
+	Manga       string             `xml:",omitempty"`
+	Pages       []ComicInfoPage    `xml:"Pages>Page,omitempty"`
+	Attrs       []xml.Attr         `xml:",any,attr"`
+	Other       []ComicInfoElement `xml:",any"` // Elements not covered by the fields above
+
+	order []string // Names of the elements in the order they were read, to write them back in it
+}
+
+type ComicInfoPage struct {
+	Image       int        `xml:",attr"` // Index of the image in the archive
+	Type        string     `xml:",attr,omitempty"`
+	DoublePage  bool       `xml:",attr,omitempty"`
+	ImageSize   int64      `xml:",attr,omitempty"`
+	Key         string     `xml:",attr,omitempty"`
+	Bookmark    string     `xml:",attr,omitempty"`
+	ImageWidth  int        `xml:",attr,omitempty"`
+	ImageHeight int        `xml:",attr,omitempty"`
+	Attrs       []xml.Attr `xml:",any,attr"`
+}
+
+type ComicInfoElement struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content string     `xml:",innerxml"`
+}
+
+// MetadataProvider is implemented by archives that can carry ComicInfo.xml metadata
+type MetadataProvider interface {
+	Metadata() *ComicInfo // nil if there is none
+}
+
+// MetadataDiscoverer is implemented by metadata providers that may only find the metadata some
+// time after the archive is opened
+type MetadataDiscoverer interface {
+	// OnMetadataKnown sets the function to call, possibly from another goroutine, once Metadata
+	// returns its final value. It is called right away if that's already the case
+	OnMetadataKnown(notify func())
+}
+
+func ParseComicInfo(r io.Reader) (*ComicInfo, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var ci ComicInfo
+	if err := xml.Unmarshal(data, &ci); err != nil {
+		return nil, err
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch el := t.(type) {
+		case xml.StartElement:
+			if depth == 1 {
+				ci.order = append(ci.order, el.Name.Local)
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return &ci, nil
+}
+
+// RightToLeft reports whether the pages are meant to be read from right to left
+func (ci *ComicInfo) RightToLeft() bool {
+	return ci.Manga == MangaYesAndRightToLeft
+}
+
+// Page returns the metadata of the i-th image in the archive, or nil if there is none
+func (ci *ComicInfo) Page(i int) *ComicInfoPage {
+	for j := range ci.Pages {
+		if ci.Pages[j].Image == i {
+			return &ci.Pages[j]
+		}
+	}
+	return nil
+}
+
+func isComicInfo(name string) bool {
+	return strings.EqualFold(path.Base(name), ComicInfoFilename)
+}
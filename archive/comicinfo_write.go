@@ -0,0 +1,338 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+)
+
+// MetadataWriter is implemented by archives that ComicInfo.xml metadata can be written into
+type MetadataWriter interface {
+	WriteMetadata(ci *ComicInfo) error
+}
+
+var comicInfoNamespaces = []xml.Attr{
+	{Name: xml.Name{Local: "xmlns:xsi"}, Value: "http://www.w3.org/2001/XMLSchema-instance"},
+	{Name: xml.Name{Local: "xmlns:xsd"}, Value: "http://www.w3.org/2001/XMLSchema"},
+}
+
+// comicInfoSchemaOrder is the order of the elements in version 2.1 of the ComicInfo schema, which
+// doesn't allow for any other
+var comicInfoSchemaOrder = []string{
+	"Title", "Series", "Number", "Count", "Volume", "AlternateSeries", "AlternateNumber",
+	"AlternateCount", "Summary", "Notes", "Year", "Month", "Day", "Writer", "Penciller", "Inker",
+	"Colorist", "Letterer", "CoverArtist", "Editor", "Translator", "Publisher", "Imprint", "Genre",
+	"Tags", "Web", "PageCount", "LanguageISO", "Format", "BlackAndWhite", "Manga", "Characters",
+	"Teams", "Locations", "ScanInformation", "StoryArc", "StoryArcNumber", "SeriesGroup",
+	"AgeRating", "Pages", "CommunityRating", "MainCharacterOrTeam", "Review", "GTIN",
+}
+
+// comicInfoElement is an element to be written: either one covered by a field of ComicInfo,
+// given by its name, or one of the others
+type comicInfoElement struct {
+	field string
+	other *ComicInfoElement
+}
+
+func (el comicInfoElement) name() string {
+	if el.other != nil {
+		return el.other.XMLName.Local
+	}
+	return el.field
+}
+
+// textFields returns the values of the fields of ci holding the text of an element, by the name
+// of the element
+func (ci *ComicInfo) textFields() map[string]string {
+	return map[string]string{
+		"Title":       ci.Title,
+		"Series":      ci.Series,
+		"Number":      ci.Number,
+		"Count":       ci.Count,
+		"Volume":      ci.Volume,
+		"Summary":     ci.Summary,
+		"Year":        ci.Year,
+		"Month":       ci.Month,
+		"Day":         ci.Day,
+		"Writer":      ci.Writer,
+		"Penciller":   ci.Penciller,
+		"Inker":       ci.Inker,
+		"Colorist":    ci.Colorist,
+		"Letterer":    ci.Letterer,
+		"CoverArtist": ci.CoverArtist,
+		"Editor":      ci.Editor,
+		"Publisher":   ci.Publisher,
+		"Genre":       ci.Genre,
+		"Web":         ci.Web,
+		"LanguageISO": ci.LanguageISO,
+		"Manga":       ci.Manga,
+	}
+}
+
+// elements returns the elements to write, in the order they were read in. Elements that weren't
+// there are put where the schema wants them
+func (ci *ComicInfo) elements(fields map[string]string) []comicInfoElement {
+	isField := func(name string) bool {
+		_, ok := fields[name]
+		return ok || name == "Pages"
+	}
+
+	var elements []comicInfoElement
+	written := make(map[string]bool)
+	others := ci.Other
+	for _, name := range ci.order {
+		if isField(name) {
+			if !written[name] {
+				elements = append(elements, comicInfoElement{field: name})
+				written[name] = true
+			}
+		} else if len(others) > 0 {
+			elements = append(elements, comicInfoElement{other: &others[0]})
+			others = others[1:]
+		}
+	}
+	for i := range others {
+		elements = append(elements, comicInfoElement{other: &others[i]})
+	}
+
+	rank := make(map[string]int, len(comicInfoSchemaOrder))
+	for i, name := range comicInfoSchemaOrder {
+		rank[name] = i
+	}
+	for _, name := range comicInfoSchemaOrder {
+		if !isField(name) || written[name] {
+			continue
+		}
+		// Before the first element that comes later in the schema
+		at := len(elements)
+		for i, el := range elements {
+			if r, ok := rank[el.name()]; ok && r > rank[name] {
+				at = i
+				break
+			}
+		}
+		elements = slices.Insert(elements, at, comicInfoElement{field: name})
+	}
+	return elements
+}
+
+// Marshal encodes the metadata as the contents of a ComicInfo.xml file, keeping the order of the
+// elements that were read
+func (ci *ComicInfo) Marshal() ([]byte, error) {
+	// encoding/xml can't reproduce namespace declarations faithfully, so we write the usual ones
+	// and drop all namespaced attributes
+	attrs := append([]xml.Attr{}, comicInfoNamespaces...)
+	for _, attr := range ci.Attrs {
+		if attr.Name.Space == "" && attr.Name.Local != "xmlns" {
+			attrs = append(attrs, attr)
+		}
+	}
+	pages := append([]ComicInfoPage{}, ci.Pages...)
+	sort.Slice(pages, func(i, j int) bool { return pages[i].Image < pages[j].Image })
+	fields := ci.textFields()
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	root := xml.StartElement{Name: xml.Name{Local: "ComicInfo"}, Attr: attrs}
+	if err := enc.EncodeToken(root); err != nil {
+		return nil, err
+	}
+	for _, el := range ci.elements(fields) {
+		start := xml.StartElement{Name: xml.Name{Local: el.field}}
+		var err error
+		switch {
+		case el.other != nil:
+			err = enc.Encode(el.other)
+		case el.field == "Pages":
+			if len(pages) > 0 {
+				err = enc.EncodeElement(struct{ Page []ComicInfoPage }{pages}, start)
+			}
+		case fields[el.field] != "":
+			err = enc.EncodeElement(fields[el.field], start)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.EncodeToken(root.End()); err != nil {
+		return nil, err
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// SetPageType sets the type of the i-th image in the archive, adding an entry for it if needed
+func (ci *ComicInfo) SetPageType(i int, pageType string) {
+	if page := ci.Page(i); page != nil {
+		page.Type = pageType
+		return
+	}
+	if pageType == "" {
+		return
+	}
+	ci.Pages = append(ci.Pages, ComicInfoPage{Image: i, Type: pageType})
+}
+
+// WriteMetadata replaces the zip file with one containing the given metadata. The file is closed
+// for that, since Windows doesn't allow renaming over open files, and then read again
+func (ar *Zip) WriteMetadata(ci *ComicInfo) error {
+	if ar.path == "" {
+		return errors.New("Writing metadata into nested archives is not supported")
+	}
+
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if err := ar.closer.Close(); err != nil {
+		return err
+	}
+	writeErr := writeZipComicInfo(ar.path, ci)
+	// Reopened even if writing failed, in which case the file is unchanged
+	if err := ar.reopen(); err != nil {
+		return fmt.Errorf("reopening %s: %v", ar.name, err)
+	}
+	return writeErr
+}
+
+// reopen reads the zip file again, replacing everything known about it
+func (ar *Zip) reopen() error {
+	f, err := os.Open(ar.path)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	reopened, err := newZip(ar.name, f, fi.Size(), f, ar.password)
+	if err != nil {
+		return err
+	}
+	ar.files, ar.closer, ar.comicInfo = reopened.files, reopened.closer, reopened.comicInfo
+	return nil
+}
+
+// writeZipComicInfo replaces the ComicInfo.xml in the zip file at path. To not risk damaging the
+// file, a new zip is built next to it first and then renamed over it. The other files are copied
+// without recompressing them
+func writeZipComicInfo(path string, ci *ComicInfo) error {
+	data, err := ci.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomically(path, func(f *os.File) error {
+		// Opened in here to be closed before the rename
+		src, err := zip.OpenReader(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		w := zip.NewWriter(f)
+		for _, file := range src.File {
+			if isComicInfo(file.Name) {
+				continue
+			}
+			if err := w.Copy(file); err != nil {
+				return err
+			}
+		}
+		fw, err := w.CreateHeader(&zip.FileHeader{
+			Name:     ComicInfoFilename,
+			Method:   zip.Deflate,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(data); err != nil {
+			return err
+		}
+		if err := w.SetComment(src.Comment); err != nil {
+			return err
+		}
+		return w.Close()
+	})
+}
+
+func (ar *Dir) WriteMetadata(ci *ComicInfo) error {
+	data, err := ci.Marshal()
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomically(filepath.Join(ar.path, ar.comicInfoFilename()), func(f *os.File) error {
+		_, err := f.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	ar.comicInfo = ci
+	return nil
+}
+
+// writeFileAtomically replaces the file at path with the output of write, going through
+// a temporary file in the same directory
+func writeFileAtomically(path string, write func(f *os.File) error) (err error) {
+	perm := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		perm = fi.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = write(tmp); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteZipComicInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	files := map[string][]byte{
+		"1.png":         []byte("Not really an image"),
+		"notes.txt":     []byte("Notes"),
+		"ComicInfo.xml": []byte("<ComicInfo><Series>Old</Series></ComicInfo>"),
+	}
+	for name, data := range files {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(data)
+	}
+	w.SetComment("Comment")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if err := writeZipComicInfo(path, &ComicInfo{Series: "New"}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.Comment != "Comment" {
+		t.Errorf("comment = %q, want %q", r.Comment, "Comment")
+	}
+	got := make(map[string][]byte)
+	for _, file := range r.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[file.Name] = data
+	}
+	if len(got) != len(files) {
+		t.Errorf("files = %d, want %d", len(got), len(files))
+	}
+	for _, name := range []string{"1.png", "notes.txt"} {
+		if !bytes.Equal(got[name], files[name]) {
+			t.Errorf("%s was not preserved", name)
+		}
+	}
+	ci, err := ParseComicInfo(bytes.NewReader(got[ComicInfoFilename]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ci.Series != "New" {
+		t.Errorf("Series = %q, want %q", ci.Series, "New")
+	}
+}
+
+func TestComicInfoMarshalOrder(t *testing.T) {
+	ci, err := ParseComicInfo(strings.NewReader(`<ComicInfo>` +
+		`<Series>Series</Series><AlternateSeries>Other</AlternateSeries><PageCount>2</PageCount>` +
+		`<AgeRating>Everyone</AgeRating><Pages><Page Image="0" Type="FrontCover"/></Pages><GTIN>1</GTIN>` +
+		`</ComicInfo>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ci.Title = "Title"
+	ci.Manga = MangaYes
+
+	data, err := ci.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for depth := 0; ; {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			if depth == 1 {
+				names = append(names, el.Name.Local)
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	want := []string{"Title", "Series", "AlternateSeries", "PageCount", "Manga", "AgeRating", "Pages", "GTIN"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("elements = %q, want %q", names, want)
+	}
+}
+
+func TestZipWriteMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cbz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	fw, err := w.Create("1.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("Not really an image"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	ar, err := NewZip(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ar.Close()
+
+	if err := ar.WriteMetadata(&ComicInfo{Series: "New"}); err != nil {
+		t.Fatal(err)
+	}
+	if ci := ar.Metadata(); ci == nil || ci.Series != "New" {
+		t.Errorf("Metadata() = %+v, want the series New", ci)
+	}
+	// The archive must still be readable after being replaced
+	page, err := ar.Load(context.Background(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(page.Data) != "Not really an image" {
+		t.Errorf("page data = %q", page.Data)
+	}
+}
@@ -19,25 +19,47 @@
 package archive
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
-
-	"github.com/fauu/gomicsv/pixbuf"
-	"github.com/gotk3/gotk3/gdk"
+	"strings"
+	"sync"
 )
 
 type Dir struct {
-	filenames filenames
+	mu        sync.RWMutex // Guards filenames, which can change while watched
+	filenames filenames    // Relative to path
 	name      string
 	path      string
+	recursive bool
+
+	comicInfo     *ComicInfo
+	comicInfoName string // Filename of the existing ComicInfo.xml, whose case may differ
+
+	watcher   *dirWatcher
+	pendingMu sync.Mutex
+	pending   []dirChange // Changes noticed by the watcher, yet to be applied by Sync
+}
+
+// dirChange is an image (or, if dir is set, a directory) that has appeared or disappeared
+type dirChange struct {
+	name    string // Relative to path
+	removed bool
+	dir     bool
 }
 
-/* Reads filenames from a directory, and sorts them */
-func NewDir(path string) (*Dir, error) {
+// NewDir reads filenames from a directory, and sorts them. If recursive is true, images from the
+// whole directory tree are included, named by their paths relative to the directory
+func NewDir(path string, recursive bool) (*Dir, error) {
+	if recursive {
+		return newDirRecursive(path)
+	}
+
 	subPath, err := findFirstDirContainingSupportedImage(path)
 	if err != nil {
 		return nil, fmt.Errorf("searching for supported images in provided path: %v", err)
@@ -65,6 +87,13 @@ func NewDir(path string) (*Dir, error) {
 	ar.filenames = make([]string, 0, len(filenames))
 
 	for _, name := range filenames {
+		if isComicInfo(name) {
+			ar.comicInfoName = name
+			if ar.comicInfo, err = readDirComicInfo(filepath.Join(ar.path, name)); err != nil {
+				log.Printf("Error reading %s from %s: %v", ComicInfoFilename, ar.name, err)
+			}
+			continue
+		}
 		if !extensionMatches(name, imageExtensions) {
 			continue
 		}
@@ -80,6 +109,77 @@ func NewDir(path string) (*Dir, error) {
 	return &ar, nil
 }
 
+func newDirRecursive(path string) (*Dir, error) {
+	ar := Dir{
+		filenames: make([]string, 0),
+		name:      filepath.Base(path),
+		path:      path,
+		recursive: true,
+	}
+
+	err := filepath.WalkDir(path, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if p == path {
+				return err
+			}
+			log.Printf("Error while walking the directory tree: %v", err)
+			return nil
+		}
+		if p != path && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		if rel == entry.Name() && isComicInfo(rel) {
+			ar.comicInfoName = rel
+			if ar.comicInfo, err = readDirComicInfo(p); err != nil {
+				log.Printf("Error reading %s from %s: %v", ComicInfoFilename, ar.name, err)
+			}
+			return nil
+		}
+		if extensionMatches(rel, imageExtensions) {
+			ar.filenames = append(ar.filenames, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ar.filenames) == 0 {
+		return nil, errors.New(ar.name + ": no images in the directory tree")
+	}
+
+	sort.Sort(ar.filenames)
+
+	return &ar, nil
+}
+
+func readDirComicInfo(path string) (*ComicInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseComicInfo(f)
+}
+
+func (ar *Dir) comicInfoFilename() string {
+	if ar.comicInfoName != "" {
+		return ar.comicInfoName
+	}
+	return ComicInfoFilename
+}
+
 func (ar *Dir) checkbounds(i int) error {
 	if i < 0 || i >= len(ar.filenames) {
 		return ErrBounds
@@ -87,19 +187,27 @@ func (ar *Dir) checkbounds(i int) error {
 	return nil
 }
 
-func (ar *Dir) Load(i int, autorotate bool, _nPreload int) (*gdk.Pixbuf, error) {
+func (ar *Dir) Load(ctx context.Context, i int, _nPreload int) (*Page, error) {
+	ar.mu.RLock()
 	if err := ar.checkbounds(i); err != nil {
+		ar.mu.RUnlock()
 		return nil, err
 	}
+	name := ar.filenames[i]
+	ar.mu.RUnlock()
 
-	path := filepath.Join(ar.path, ar.filenames[i])
-	f, err := os.Open(path)
+	f, err := os.Open(filepath.Join(ar.path, name))
 	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			// The watcher might not have noticed yet, so that Sync would not drop the page
+			ar.queueChanges([]dirChange{{name: name, removed: true}})
+			return nil, fmt.Errorf("%s: %w", name, ErrPageRemoved)
+		}
 		return nil, err
 	}
 
 	defer f.Close()
-	return pixbuf.Load(f, autorotate)
+	return readPage(ctx, name, f)
 }
 
 func (ar *Dir) ArchiveName() string {
@@ -107,6 +215,8 @@ func (ar *Dir) ArchiveName() string {
 }
 
 func (ar *Dir) Name(i int) (string, error) {
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
 	if err := ar.checkbounds(i); err != nil {
 		return "", err
 	}
@@ -114,19 +224,111 @@ func (ar *Dir) Name(i int) (string, error) {
 	return ar.filenames[i], nil
 }
 
+// IndexOf returns the index of the image with the given filename, or -1 if there isn't one
+func (ar *Dir) IndexOf(filename string) int {
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+	for i, name := range ar.filenames {
+		if name == filename {
+			return i
+		}
+	}
+	return -1
+}
+
 func (ar *Dir) Kind() Kind {
 	return Unpacked
 }
 
 func (ar *Dir) Len() *int {
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
 	l := len(ar.filenames)
 	return &l
 }
 
+func (ar *Dir) Metadata() *ComicInfo {
+	return ar.comicInfo
+}
+
 func (ar *Dir) Close() error {
+	ar.closeWatcher()
 	return nil
 }
 
+func (ar *Dir) queueChanges(changes []dirChange) {
+	ar.pendingMu.Lock()
+	defer ar.pendingMu.Unlock()
+	ar.pending = append(ar.pending, changes...)
+}
+
+func (ar *Dir) Sync() []IndexChange {
+	ar.pendingMu.Lock()
+	changes := ar.pending
+	ar.pending = nil
+	ar.pendingMu.Unlock()
+
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	var indexChanges []IndexChange
+	for _, c := range changes {
+		switch {
+		case c.removed && c.dir:
+			indexChanges = append(indexChanges, ar.removeFilenamesUnder(c.name)...)
+		case c.removed:
+			if i := ar.removeFilename(c.name); i != -1 {
+				indexChanges = append(indexChanges, IndexChange{i, PageRemoved})
+			}
+		case extensionMatches(c.name, imageExtensions) && !strings.HasPrefix(filepath.Base(c.name), "."):
+			indexChanges = append(indexChanges, ar.insertFilename(c.name))
+		}
+	}
+	return indexChanges
+}
+
+// insertFilename inserts name keeping the filenames sorted. If it is already there, the file has
+// been written over
+func (ar *Dir) insertFilename(name string) IndexChange {
+	i := sort.Search(len(ar.filenames), func(i int) bool {
+		return !strcmp(ar.filenames[i], name, true)
+	})
+	if i < len(ar.filenames) && ar.filenames[i] == name {
+		return IndexChange{i, PageModified}
+	}
+	ar.filenames = append(ar.filenames, "")
+	copy(ar.filenames[i+1:], ar.filenames[i:])
+	ar.filenames[i] = name
+	return IndexChange{i, PageInserted}
+}
+
+// removeFilename removes name, returning its index, or -1 if it wasn't there
+func (ar *Dir) removeFilename(name string) int {
+	for i, n := range ar.filenames {
+		if n == name {
+			ar.filenames = append(ar.filenames[:i], ar.filenames[i+1:]...)
+			return i
+		}
+	}
+	return -1
+}
+
+func (ar *Dir) removeFilenamesUnder(dir string) []IndexChange {
+	prefix := dir + string(filepath.Separator)
+	var changes []IndexChange
+	kept := ar.filenames[:0]
+	for i, n := range ar.filenames {
+		if strings.HasPrefix(n, prefix) {
+			// Each removal shifts the pages after it
+			changes = append(changes, IndexChange{i - len(changes), PageRemoved})
+		} else {
+			kept = append(kept, n)
+		}
+	}
+	ar.filenames = kept
+	return changes
+}
+
 func findFirstDirContainingSupportedImage(path string) (*string, error) {
 	dir, err := os.Open(path)
 	if err != nil {
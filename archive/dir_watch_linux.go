@@ -0,0 +1,196 @@
+//go:build linux
+
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package archive
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const dirWatchMask = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_DELETE | unix.IN_MOVED_FROM |
+	unix.IN_CREATE | unix.IN_ONLYDIR
+
+type dirWatcher struct {
+	fd   int
+	file *os.File       // Wraps fd, so that closing it interrupts a pending read
+	dirs map[int]string // Watch descriptor -> directory relative to the archive's path
+}
+
+// Watch starts watching the directory (and in recursive mode, its subdirectories) with inotify
+func (ar *Dir) Watch(notify func()) error {
+	if ar.watcher != nil {
+		return errors.New("The directory is already being watched")
+	}
+
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return err
+	}
+	w := &dirWatcher{
+		fd:   fd,
+		file: os.NewFile(uintptr(fd), "inotify"),
+		dirs: make(map[int]string),
+	}
+
+	if err := w.add(ar.path, "."); err != nil {
+		w.file.Close()
+		return err
+	}
+	if ar.recursive {
+		for _, dir := range listSubdirs(ar.path, ".") {
+			if err := w.add(ar.path, dir); err != nil {
+				log.Printf("Error watching %s: %v", dir, err)
+			}
+		}
+	}
+
+	ar.watcher = w
+	go ar.watch(w, notify)
+
+	return nil
+}
+
+func (w *dirWatcher) add(root, dir string) error {
+	wd, err := unix.InotifyAddWatch(w.fd, filepath.Join(root, dir), dirWatchMask)
+	if err != nil {
+		return err
+	}
+	w.dirs[wd] = dir
+	return nil
+}
+
+func (ar *Dir) watch(w *dirWatcher, notify func()) {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				log.Printf("Error watching %s: %v", ar.name, err)
+			}
+			return
+		}
+
+		var changes []dirChange
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			offset = nameStart + int(event.Len)
+			if offset > n {
+				break
+			}
+			name := strings.TrimRight(string(buf[nameStart:offset]), "\x00")
+
+			if event.Mask&unix.IN_IGNORED != 0 {
+				delete(w.dirs, int(event.Wd))
+				continue
+			}
+			dir, ok := w.dirs[int(event.Wd)]
+			if !ok || name == "" || strings.HasPrefix(name, ".") {
+				continue
+			}
+			rel := filepath.Join(dir, name)
+
+			switch {
+			case event.Mask&unix.IN_ISDIR != 0:
+				if !ar.recursive {
+					continue
+				}
+				if event.Mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0 {
+					changes = append(changes, dirChange{name: rel, removed: true, dir: true})
+					continue
+				}
+				// A new directory may already have contents by the time it is watched
+				for _, d := range append([]string{rel}, listSubdirs(ar.path, rel)...) {
+					if err := w.add(ar.path, d); err != nil {
+						log.Printf("Error watching %s: %v", d, err)
+					}
+				}
+				changes = append(changes, listDirTree(ar.path, rel)...)
+			case event.Mask&(unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO) != 0:
+				changes = append(changes, dirChange{name: rel})
+			case event.Mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0:
+				changes = append(changes, dirChange{name: rel, removed: true})
+			}
+		}
+
+		if len(changes) > 0 {
+			ar.queueChanges(changes)
+			notify()
+		}
+	}
+}
+
+func (ar *Dir) closeWatcher() {
+	if ar.watcher != nil {
+		ar.watcher.file.Close()
+		ar.watcher = nil
+	}
+}
+
+// listSubdirs returns the non-hidden subdirectories of root/dir, relative to root
+func listSubdirs(root, dir string) []string {
+	var dirs []string
+	walkDirTree(root, dir, func(rel string, entry fs.DirEntry) {
+		if entry.IsDir() && rel != dir {
+			dirs = append(dirs, rel)
+		}
+	})
+	return dirs
+}
+
+// listDirTree returns the files found in root/dir as pending additions
+func listDirTree(root, dir string) []dirChange {
+	var changes []dirChange
+	walkDirTree(root, dir, func(rel string, entry fs.DirEntry) {
+		if !entry.IsDir() {
+			changes = append(changes, dirChange{name: rel})
+		}
+	})
+	return changes
+}
+
+func walkDirTree(root, dir string, fn func(rel string, entry fs.DirEntry)) {
+	start := filepath.Join(root, dir)
+	filepath.WalkDir(start, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if p != start && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil
+		}
+		fn(rel, entry)
+		return nil
+	})
+}
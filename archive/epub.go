@@ -0,0 +1,388 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package archive
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const epubContainerPath = "META-INF/container.xml"
+
+// EPUB provides the pages of a (fixed-layout) EPUB comic in the order defined by the publication's
+// spine, which isn't necessarily the order of the filenames
+type EPUB struct {
+	pages    []*zip.File // Page images in spine order
+	chapters []Chapter
+	reader   *zip.ReadCloser
+	name     string
+}
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type epubPackage struct {
+	Manifest []epubManifestItem `xml:"manifest>item"`
+	Spine    []struct {
+		IDRef string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+type epubManifestItem struct {
+	ID         string `xml:"id,attr"`
+	Href       string `xml:"href,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Properties string `xml:"properties,attr"`
+}
+
+// NewEPUB reads the spine of a given EPUB file and resolves each of its items to a page image
+func NewEPUB(name string) (*EPUB, error) {
+	var err error
+
+	ar := new(EPUB)
+
+	ar.name = filepath.Base(name)
+	ar.reader, err = zip.OpenReader(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = ar.readPublication(); err != nil {
+		ar.reader.Close()
+		return nil, fmt.Errorf("%s: %v", ar.name, err)
+	}
+
+	if len(ar.pages) == 0 {
+		ar.reader.Close()
+		return nil, errors.New(ar.name + ": no images in the EPUB file")
+	}
+
+	return ar, nil
+}
+
+func (ar *EPUB) readPublication() error {
+	files := make(map[string]*zip.File, len(ar.reader.File))
+	for _, f := range ar.reader.File {
+		files[f.Name] = f
+	}
+
+	var container epubContainer
+	if err := decodeZipXML(files, epubContainerPath, &container); err != nil {
+		return err
+	}
+	opfPath := ""
+	for _, rootfile := range container.Rootfiles {
+		if rootfile.MediaType == "" || rootfile.MediaType == "application/oebps-package+xml" {
+			opfPath = rootfile.FullPath
+			break
+		}
+	}
+	if opfPath == "" {
+		return errors.New("no package document in the container")
+	}
+
+	var pkg epubPackage
+	if err := decodeZipXML(files, opfPath, &pkg); err != nil {
+		return err
+	}
+
+	manifest := make(map[string]epubManifestItem, len(pkg.Manifest))
+	var navPath string
+	for _, item := range pkg.Manifest {
+		manifest[item.ID] = item
+		if hasProperty(item.Properties, "nav") {
+			navPath = epubResolveHref(opfPath, item.Href)
+		}
+	}
+
+	// Document path -> index of its first page, for resolving the chapters
+	pageOfDocument := make(map[string]int)
+	for _, itemRef := range pkg.Spine {
+		item, ok := manifest[itemRef.IDRef]
+		if !ok {
+			continue
+		}
+		itemPath := epubResolveHref(opfPath, item.Href)
+
+		imagePath := itemPath
+		if !strings.HasPrefix(item.MediaType, "image/") {
+			var err error
+			imagePath, err = findPageImage(files, itemPath)
+			if err != nil {
+				return fmt.Errorf("reading %s: %v", itemPath, err)
+			}
+			if imagePath == "" {
+				// A text-only document, probably
+				continue
+			}
+		}
+
+		f, ok := files[imagePath]
+		if !ok || !extensionMatches(imagePath, imageExtensions) {
+			continue
+		}
+		if _, ok := pageOfDocument[itemPath]; !ok {
+			pageOfDocument[itemPath] = len(ar.pages)
+		}
+		ar.pages = append(ar.pages, f)
+	}
+
+	if navPath != "" {
+		chapters, err := readEPUBNav(files, navPath, pageOfDocument)
+		if err != nil {
+			// Not essential
+			return nil
+		}
+		// The table of contents needn't follow the reading order
+		sort.SliceStable(chapters, func(i, j int) bool { return chapters[i].Start < chapters[j].Start })
+		ar.chapters = chapters
+	}
+
+	return nil
+}
+
+// findPageImage returns the path of the first image referenced by an XHTML or SVG document,
+// or an empty string if there isn't one
+func findPageImage(files map[string]*zip.File, docPath string) (string, error) {
+	d, closer, err := openZipXHTML(files, docPath)
+	if err != nil {
+		return "", err
+	}
+	defer closer.Close()
+
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		el, ok := t.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		var href string
+		switch el.Name.Local {
+		case "img":
+			href = xmlAttr(el, "src")
+		case "image":
+			href = xmlAttr(el, "href") // xlink:href in SVG
+		}
+		if href != "" {
+			return epubResolveHref(docPath, href), nil
+		}
+	}
+}
+
+// readEPUBNav extracts the chapters from the table of contents in the EPUB navigation document
+func readEPUBNav(files map[string]*zip.File, navPath string, pageOfDocument map[string]int) ([]Chapter, error) {
+	d, closer, err := openZipXHTML(files, navPath)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	var chapters []Chapter
+	inTOC := false
+	navDepth := 0
+	var link *Chapter
+	var title strings.Builder
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch el := t.(type) {
+		case xml.StartElement:
+			if el.Name.Local == "nav" {
+				if inTOC {
+					navDepth++
+				} else if xmlAttr(el, "type") == "toc" {
+					inTOC = true
+				}
+				continue
+			}
+			if !inTOC || el.Name.Local != "a" {
+				continue
+			}
+			href := xmlAttr(el, "href")
+			if i := strings.IndexByte(href, '#'); i >= 0 {
+				href = href[:i]
+			}
+			page, ok := pageOfDocument[epubResolveHref(navPath, href)]
+			if !ok {
+				continue
+			}
+			link = &Chapter{Start: page}
+			title.Reset()
+		case xml.CharData:
+			if link != nil {
+				title.Write(el)
+			}
+		case xml.EndElement:
+			if inTOC && el.Name.Local == "nav" {
+				if navDepth == 0 {
+					return chapters, nil
+				}
+				navDepth--
+			}
+			if link != nil && el.Name.Local == "a" {
+				link.Title = strings.Join(strings.Fields(title.String()), " ")
+				chapters = append(chapters, *link)
+				link = nil
+			}
+		}
+	}
+	return chapters, nil
+}
+
+func decodeZipXML(files map[string]*zip.File, name string, v interface{}) error {
+	d, closer, err := openZipXML(files, name)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	return d.Decode(v)
+}
+
+func openZipXML(files map[string]*zip.File, name string) (*xml.Decoder, io.Closer, error) {
+	f, ok := files[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("%s not found", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	return xml.NewDecoder(rc), rc, nil
+}
+
+// openZipXHTML is openZipXML for content documents. It's lenient towards documents that are
+// HTML rather than XHTML, which mustn't extend to the package document, where <meta> isn't void.
+func openZipXHTML(files map[string]*zip.File, name string) (*xml.Decoder, io.Closer, error) {
+	d, closer, err := openZipXML(files, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	return d, closer, nil
+}
+
+func xmlAttr(el xml.StartElement, name string) string {
+	for _, attr := range el.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func hasProperty(properties string, property string) bool {
+	for _, p := range strings.Fields(properties) {
+		if p == property {
+			return true
+		}
+	}
+	return false
+}
+
+// epubResolveHref resolves a (URL-encoded) reference relative to the document containing it into
+// a path inside the archive
+func epubResolveHref(basePath string, href string) string {
+	if i := strings.IndexByte(href, '#'); i >= 0 {
+		href = href[:i]
+	}
+	if unescaped, err := url.PathUnescape(href); err == nil {
+		href = unescaped
+	}
+	if strings.HasPrefix(href, "/") {
+		return strings.TrimPrefix(path.Clean(href), "/")
+	}
+	return path.Join(path.Dir(basePath), href)
+}
+
+func (ar *EPUB) checkbounds(i int) error {
+	if i < 0 || i >= len(ar.pages) {
+		return ErrBounds
+	}
+	return nil
+}
+
+func (ar *EPUB) Load(ctx context.Context, i int, _nPreload int) (*Page, error) {
+	if err := ar.checkbounds(i); err != nil {
+		return nil, err
+	}
+
+	f, err := ar.pages[i].Open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return readPage(ctx, ar.pages[i].Name, f)
+}
+
+func (ar *EPUB) Kind() Kind {
+	return Packed
+}
+
+func (ar *EPUB) ArchiveName() string {
+	return ar.name
+}
+
+func (ar *EPUB) Name(i int) (string, error) {
+	if err := ar.checkbounds(i); err != nil {
+		return "", err
+	}
+
+	return ar.pages[i].Name, nil
+}
+
+func (ar *EPUB) Len() *int {
+	l := len(ar.pages)
+	return &l
+}
+
+// Chapters returns the chapters listed in the publication's table of contents, if it has one
+func (ar *EPUB) Chapters() []Chapter {
+	return ar.chapters
+}
+
+func (ar *EPUB) Close() error {
+	return ar.reader.Close()
+}
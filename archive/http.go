@@ -19,18 +19,17 @@
 package archive
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"mime"
 	"net/http"
-	"regexp"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/gotk3/gotk3/gdk"
-
-	"github.com/fauu/gomicsv/pagecache"
-	"github.com/fauu/gomicsv/pixbuf"
+	"github.com/fauu/gomicsv/httpcache"
 )
 
 const (
@@ -38,36 +37,74 @@ const (
 )
 
 type HTTP struct {
-	urlTemplate          string
-	referer              string
-	firstPageOffset      int
-	pageCache            *pagecache.PageCache
-	fetchInProgress      map[int]bool
-	fetchInProgressMutex sync.Mutex
+	urlTemplate     string
+	gallery         *Gallery // Set instead of urlTemplate for the chapters scraped from HTML pages
+	galleryURL      string
+	client          *http.Client
+	headers         map[string]string    // Sent with every request
+	cache           *httpcache.HTTPCache // Nil if the pages are not to be cached on disk
+	firstPageOffset int
+	pages           map[int]*Page // Downloaded pages around the last loaded one
+	pagesMutex      sync.Mutex
+	fetches         map[int]*pageFetch // Downloads in progress
+	fetchesMutex    sync.Mutex
+	bounds          httpBounds
+	boundsMutex     sync.Mutex
+	onLenKnown      func()
+	ctx             context.Context // Done once the archive is closed
+	cancel          context.CancelFunc
 }
 
-func NewHTTP(url string, pageCache *pagecache.PageCache, referer string) (*HTTP, error) {
-	if !isPageURLTemplate(url) {
-		var ok bool
-		url, ok = tryMakeURLTemplateFromSampleURL(url)
-		if !ok {
-			return nil, errors.New("Couldn't determine the URL template from the sample URL")
+// pageFetch is a download of a page, shared by everyone waiting for the page
+type pageFetch struct {
+	done    chan struct{}
+	page    *Page // Valid once done is closed
+	err     error
+	cancel  context.CancelFunc
+	waiters int  // Guarded by fetchesMutex
+	preload bool // Whether the page is wanted even with no waiters. Guarded by fetchesMutex
+}
+
+// httpBounds is what is known about the length of an HTTP archive
+type httpBounds struct {
+	maxPresent int  // The index of the last page known to exist
+	minAbsent  int  // The index of the first page known not to exist, or -1
+	known      bool // Whether the length, minAbsent, is certain
+}
+
+// NewHTTP opens the archive of the images at the URLs given by a template with the page number
+// replaced with %d, or by a sample URL of one of them. With opts.HTTPProbeLength, the length is
+// looked for in the background, by requesting pages further and further away and then bisecting
+func NewHTTP(url string, opts Options) (*HTTP, error) {
+	if !IsPageURLTemplate(url) {
+		candidates, err := InferURLTemplates(context.Background(), url, opts)
+		if err != nil {
+			return nil, err
 		}
+		url = candidates[0].Template
+		log.Printf("Using the URL template %s", url)
+	}
+
+	client, headers, err := httpClientFor(fmt.Sprintf(url, 1), opts)
+	if err != nil {
+		return nil, err
 	}
 
 	newHTTP := HTTP{
-		urlTemplate:          url,
-		referer:              referer,
-		pageCache:            pageCache,
-		fetchInProgress:      make(map[int]bool),
-		fetchInProgressMutex: sync.Mutex{},
+		urlTemplate: url,
+		client:      client,
+		headers:     headers,
+		cache:       opts.HTTPCache,
+		pages:       make(map[int]*Page),
+		fetches:     make(map[int]*pageFetch),
 	}
+	newHTTP.ctx, newHTTP.cancel = context.WithCancel(context.Background())
 
 	firstPageIdx := 0
-	var firstPixbuf *gdk.Pixbuf
+	var firstPage *Page
 	for firstPageIdx < 2 {
 		var err error
-		firstPixbuf, err = newHTTP.downloadImage(firstPageIdx, false)
+		firstPage, err = newHTTP.downloadPage(newHTTP.ctx, firstPageIdx)
 		if err != nil {
 			log.Printf("First image not located at index %d", firstPageIdx)
 		} else {
@@ -75,78 +112,164 @@ func NewHTTP(url string, pageCache *pagecache.PageCache, referer string) (*HTTP,
 		}
 		firstPageIdx++
 	}
-	if firstPixbuf == nil {
+	if firstPage == nil {
+		newHTTP.cancel()
 		return nil, errors.New("Couldn't locate the first image")
 	}
 
 	newHTTP.firstPageOffset = firstPageIdx
-	pageCache.Insert(0, firstPixbuf, pagecache.KeepReasonPreload)
+	newHTTP.bounds = httpBounds{maxPresent: 0, minAbsent: -1}
+	newHTTP.setPage(0, firstPage)
+
+	if opts.HTTPProbeLength {
+		go newHTTP.probeLen()
+	}
 
 	return &newHTTP, nil
 }
 
-func (ar *HTTP) Load(i int, autorotate bool, nPreload int) (*gdk.Pixbuf, error) {
-	var pixbuf *gdk.Pixbuf
+// httpClientFor returns the client and the headers to request the given URL with, according to
+// the HTTP profile it matches
+func httpClientFor(url string, opts Options) (*http.Client, map[string]string, error) {
+	profile, err := MatchHTTPProfile(opts.HTTPProfiles, url)
+	if err != nil {
+		return nil, nil, err
+	}
+	return httpClientForProfile(profile, opts)
+}
+
+// httpClientForProfile returns the client and the headers to make requests with according to the
+// HTTP profile, which can be nil
+func httpClientForProfile(profile *HTTPProfile, opts Options) (*http.Client, map[string]string, error) {
 	var err error
-	cached, isCached := ar.pageCache.Get(i)
-	if !isCached {
-		if downloading := ar.getAndSetPageFetchInProgress(i, true); downloading {
-			// Wait until downloading done
-			var tries = 10
-			for range time.Tick(time.Millisecond * 500) {
-				cached, isCached = ar.pageCache.Get(i)
-				if isCached {
-					break
-				}
-				if tries <= 0 {
-					return nil, fmt.Errorf("Ran out of tries when waiting for page %d to download", i)
-				}
-				tries--
-			}
-		} else {
-			pixbuf, err = ar.downloadImage(i+ar.firstPageOffset, autorotate)
-			ar.setPageFetchInProgress(i, false)
-			if err != nil {
-				return nil, err
-			}
+	client := httpClient
+	if profile != nil {
+		log.Printf("Using the HTTP profile %q", profile.Name)
+		if client, err = profile.client(); err != nil {
+			return nil, nil, err
 		}
 	}
-	if pixbuf == nil {
-		pixbuf = cached.Pixbuf
+	return client, profile.headers(opts.HTTPReferer), nil
+}
+
+func (ar *HTTP) Load(ctx context.Context, i int, nPreload int) (*Page, error) {
+	if l := ar.Len(); i < 0 || (l != nil && i >= *l) {
+		return nil, ErrBounds
 	}
 
-	if i == 0 {
-		pixbuf, err = pixbuf.ApplyEmbeddedOrientation()
-		if err != nil {
-			return nil, err
-		}
+	page, err := ar.fetchPage(ctx, i)
+	if err != nil {
+		return nil, err
 	}
 
 	preloadStart := i - nPreload
 	preloadEnd := i + nPreload
 	for j := preloadStart; j <= preloadEnd; j++ {
-		if j < 0 || j == i {
+		if l := ar.Len(); j < 0 || j == i || (l != nil && j >= *l) {
 			continue
 		}
-		if _, ok := ar.pageCache.Get(j); !ok {
-			if downloading := ar.getAndSetPageFetchInProgress(j, true); !downloading {
-				go func(k int) {
-					pixbuf, err = ar.downloadImage(k+ar.firstPageOffset, autorotate)
-					ar.setPageFetchInProgress(k, false)
-					if err != nil {
-						log.Printf("Couldn't preload image: %v", err)
-					}
-					ar.pageCache.Insert(k, pixbuf, pagecache.KeepReasonPreload)
-				}(j)
+		ar.preloadPage(j)
+	}
+	ar.forgetPagesOutside(preloadStart, preloadEnd)
+
+	return page, nil
+}
+
+// fetchPage returns page i, downloading it unless it has been already, or waiting for it if it is
+// being downloaded. The download is abandoned once nobody waits for it
+func (ar *HTTP) fetchPage(ctx context.Context, i int) (*Page, error) {
+	if page, ok := ar.getPage(i); ok {
+		return page, nil
+	}
+
+	ar.fetchesMutex.Lock()
+	f := ar.startFetchLocked(i)
+	f.waiters++
+	ar.fetchesMutex.Unlock()
+
+	select {
+	case <-f.done:
+		return f.page, f.err
+	case <-ctx.Done():
+		ar.fetchesMutex.Lock()
+		f.waiters--
+		if f.waiters == 0 && !f.preload {
+			f.cancel()
+			if ar.fetches[i] == f {
+				delete(ar.fetches, i)
 			}
 		}
+		ar.fetchesMutex.Unlock()
+		return nil, ctx.Err()
 	}
+}
+
+// preloadPage starts downloading page i unless it has been already. The download carries on
+// regardless of whether the page is still wanted, until the archive is closed
+func (ar *HTTP) preloadPage(i int) {
+	if _, ok := ar.getPage(i); ok {
+		return
+	}
+	ar.fetchesMutex.Lock()
+	defer ar.fetchesMutex.Unlock()
+	ar.startFetchLocked(i).preload = true
+}
 
-	if !isCached {
-		ar.pageCache.Insert(i, pixbuf, pagecache.KeepReasonPreload)
+// startFetchLocked returns the download of page i in progress, starting it if there isn't one.
+// fetchesMutex must be held
+func (ar *HTTP) startFetchLocked(i int) *pageFetch {
+	if f, ok := ar.fetches[i]; ok {
+		return f
 	}
 
-	return pixbuf, nil
+	ctx, cancel := context.WithCancel(ar.ctx)
+	f := &pageFetch{done: make(chan struct{}), cancel: cancel}
+	ar.fetches[i] = f
+	go func() {
+		defer cancel()
+		page, err := ar.downloadPage(ctx, i+ar.firstPageOffset)
+		if err == nil {
+			ar.setPage(i, page)
+		}
+
+		ar.fetchesMutex.Lock()
+		if ar.fetches[i] == f {
+			delete(ar.fetches, i)
+		}
+		if err != nil && f.preload && ctx.Err() == nil && !errors.Is(err, ErrBounds) {
+			log.Printf("Couldn't preload image: %v", err)
+		}
+		ar.fetchesMutex.Unlock()
+
+		f.page, f.err = page, err
+		close(f.done)
+	}()
+	return f
+}
+
+func (ar *HTTP) getPage(i int) (*Page, bool) {
+	ar.pagesMutex.Lock()
+	defer ar.pagesMutex.Unlock()
+	page, ok := ar.pages[i]
+	return page, ok
+}
+
+func (ar *HTTP) setPage(i int, page *Page) {
+	ar.pagesMutex.Lock()
+	defer ar.pagesMutex.Unlock()
+	ar.pages[i] = page
+}
+
+// forgetPagesOutside drops the downloaded pages outside the given range. Keeping them for longer
+// is up to the user of the archive
+func (ar *HTTP) forgetPagesOutside(start, end int) {
+	ar.pagesMutex.Lock()
+	defer ar.pagesMutex.Unlock()
+	for i := range ar.pages {
+		if i < start || i > end {
+			delete(ar.pages, i)
+		}
+	}
 }
 
 func (ar *HTTP) Kind() Kind {
@@ -154,112 +277,258 @@ func (ar *HTTP) Kind() Kind {
 }
 
 func (ar *HTTP) ArchiveName() string {
+	if ar.gallery != nil {
+		return ar.galleryURL
+	}
 	return ar.urlTemplate
 }
 
 func (ar *HTTP) Name(i int) (string, error) {
-	return ar.urlTemplate, nil
+	if ar.gallery != nil {
+		if i < 0 || i >= len(ar.gallery.ImageURLs) {
+			return "", ErrBounds
+		}
+		return ar.pageURL(i), nil
+	}
+	if l := ar.Len(); i < 0 || (l != nil && i >= *l) {
+		return "", ErrBounds
+	}
+	return ar.pageURL(i + ar.firstPageOffset), nil
 }
 
 func (ar *HTTP) Len() *int {
-	// Length unknown
-	return nil
+	ar.boundsMutex.Lock()
+	defer ar.boundsMutex.Unlock()
+	if !ar.bounds.known {
+		return nil
+	}
+	l := ar.bounds.minAbsent
+	return &l
+}
+
+func (ar *HTTP) NextURL() string {
+	if ar.gallery == nil {
+		return ""
+	}
+	return ar.gallery.NextURL
+}
+
+func (ar *HTTP) PreviousURL() string {
+	if ar.gallery == nil {
+		return ""
+	}
+	return ar.gallery.PreviousURL
+}
+
+func (ar *HTTP) OnLenKnown(notify func()) {
+	ar.boundsMutex.Lock()
+	ar.onLenKnown = notify
+	known := ar.bounds.known
+	ar.boundsMutex.Unlock()
+	if known {
+		notify()
+	}
 }
 
 func (ar *HTTP) Close() error {
+	ar.cancel()
+	if ar.client != httpClient {
+		ar.client.CloseIdleConnections()
+	}
 	return nil
 }
 
-func (ar *HTTP) getAndSetPageFetchInProgress(i int, value bool) bool {
-	ar.fetchInProgressMutex.Lock()
-	defer ar.fetchInProgressMutex.Unlock()
-	_, ok := ar.fetchInProgress[i]
-	ar.doSetPageFetchInProgress(i, value)
-	return ok
+// markPresent records that page i exists
+func (ar *HTTP) markPresent(i int) {
+	ar.updateBounds(func(b *httpBounds) {
+		b.maxPresent = max(b.maxPresent, i)
+		if b.minAbsent != -1 && i >= b.minAbsent {
+			// The page that was missing has appeared after all
+			b.minAbsent = -1
+		}
+	})
 }
 
-func (ar *HTTP) setPageFetchInProgress(i int, value bool) {
-	ar.fetchInProgressMutex.Lock()
-	defer ar.fetchInProgressMutex.Unlock()
-	ar.doSetPageFetchInProgress(i, value)
+// markAbsent records that page i doesn't exist
+func (ar *HTTP) markAbsent(i int) {
+	ar.updateBounds(func(b *httpBounds) {
+		if i > b.maxPresent && (b.minAbsent == -1 || i < b.minAbsent) {
+			b.minAbsent = i
+		}
+	})
 }
 
-func (ar *HTTP) doSetPageFetchInProgress(i int, value bool) {
-	if value {
-		ar.fetchInProgress[i] = true
-	} else {
-		delete(ar.fetchInProgress, i)
+// updateBounds applies update to what is known about the length, settling the length once
+// the first missing page follows the last existing one
+func (ar *HTTP) updateBounds(update func(b *httpBounds)) {
+	ar.boundsMutex.Lock()
+	if ar.bounds.known {
+		ar.boundsMutex.Unlock()
+		return
+	}
+	update(&ar.bounds)
+	ar.bounds.known = ar.bounds.minAbsent == ar.bounds.maxPresent+1
+	known, notify := ar.bounds.known, ar.onLenKnown
+	ar.boundsMutex.Unlock()
+
+	if known {
+		log.Printf("%s has %d pages", ar.ArchiveName(), *ar.Len())
+		if notify != nil {
+			notify()
+		}
 	}
 }
 
-func (ar *HTTP) downloadImage(i int, autorotate bool) (*gdk.Pixbuf, error) {
-	url := fmt.Sprintf(ar.urlTemplate, i)
-	headers := map[string]string{"User-Agent": userAgent}
-	if ar.referer != "" {
-		headers["Referer"] = ar.referer
-	}
-	res, err := httpGet(url, headers)
-	if err != nil {
-		return nil, err
+// probeLen finds out the length by looking for a missing page with exponentially increasing
+// indices and then bisecting the range between it and the last existing page found
+func (ar *HTTP) probeLen() {
+	for i := 1; ar.Len() == nil; {
+		ar.boundsMutex.Lock()
+		b := ar.bounds
+		ar.boundsMutex.Unlock()
+
+		if b.minAbsent == -1 {
+			if i > MaxArchiveEntries {
+				return
+			}
+			i = max(i*2, b.maxPresent+1)
+		} else {
+			i = (b.maxPresent + b.minAbsent) / 2
+		}
+
+		exists, err := ar.pageExists(ar.ctx, i)
+		if err != nil {
+			if ar.ctx.Err() == nil {
+				log.Printf("Couldn't determine the length of %s: %v", ar.urlTemplate, err)
+			}
+			return
+		}
+		if exists {
+			ar.markPresent(i)
+		} else {
+			ar.markAbsent(i)
+		}
 	}
-	defer res.Body.Close()
+}
 
-	pixbuf, err := pixbuf.Load(res.Body, autorotate)
-	if err != nil {
-		return nil, err
+// pageExists checks for page i without downloading it, if the server allows
+func (ar *HTTP) pageExists(ctx context.Context, i int) (bool, error) {
+	url := ar.pageURL(i + ar.firstPageOffset)
+	if ar.cache != nil {
+		if _, ok := ar.cache.Get(url); ok {
+			return true, nil
+		}
 	}
 
-	return pixbuf, nil
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		res, err := httpFetch(ctx, ar.client, method, url, ar.requestHeaders())
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case res.StatusCode == http.StatusOK:
+			return true, nil
+		case isMissingPageStatus(res.StatusCode):
+			return false, nil
+		}
+		// Some servers don't support HEAD requests
+	}
+	return false, fmt.Errorf("%s: unexpected response status", url)
 }
 
-var pagePlaceholderRegexp = regexp.MustCompile(`%\d{0,2}d`)
+func isMissingPageStatus(status int) bool {
+	return status == http.StatusNotFound || status == http.StatusGone
+}
 
-func isPageURLTemplate(s string) bool {
-	return pagePlaceholderRegexp.MatchString(s)
+// pageURL returns the URL of the page with index i, counting from the first one that may exist
+func (ar *HTTP) pageURL(i int) string {
+	if ar.gallery != nil {
+		return ar.gallery.ImageURLs[i]
+	}
+	return fmt.Sprintf(ar.urlTemplate, i)
 }
 
-var pageParamRegexp = regexp.MustCompile(`(?:\/(\d{1,3})(?:\/|[^\d\w]))|(?:(\d{1,3})\.(?:jp|png|gif))`)
+func (ar *HTTP) downloadPage(ctx context.Context, i int) (*Page, error) {
+	url := ar.pageURL(i)
+
+	var cached *httpcache.Entry
+	if ar.cache != nil {
+		var ok bool
+		if cached, ok = ar.cache.Get(url); ok && cached.Fresh(time.Now()) {
+			ar.markPresent(i - ar.firstPageOffset)
+			return &Page{Data: cached.Data, MIMEType: cached.ContentType}, nil
+		}
+	}
 
-func tryMakeURLTemplateFromSampleURL(url string) (template string, ok bool) {
-	matches := pageParamRegexp.FindAllStringSubmatchIndex(url, -1)
-	if len(matches) < 1 {
-		return "", false
+	headers := ar.requestHeaders()
+	if cached != nil {
+		for k, v := range cached.ConditionalHeaders() {
+			headers[k] = v
+		}
 	}
-	lastMatch := matches[len(matches)-1]
-	if len(lastMatch) <= 2 {
-		return "", false
+	res, err := httpFetch(ctx, ar.client, http.MethodGet, url, headers)
+	if err == nil && res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotModified && !isMissingPageStatus(res.StatusCode) {
+		err = fmt.Errorf("%s: %s", url, res.Status)
 	}
-	for i := 2; i < len(lastMatch); i += 2 {
-		if lastMatch[i] != -1 {
-			start, end := lastMatch[i], lastMatch[i+1]
-			return url[:start] + "%d" + url[end:], true
+	if err != nil {
+		if cached != nil && ctx.Err() == nil {
+			log.Printf("Using the stale cached %s: %v", url, err)
+			return &Page{Data: cached.Data, MIMEType: cached.ContentType}, nil
 		}
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotModified && cached != nil {
+		if cached.Update(res.Header, time.Now()) {
+			ar.cachePut(cached)
+		}
+		return &Page{Data: cached.Data, MIMEType: cached.ContentType}, nil
+	}
+	if isMissingPageStatus(res.StatusCode) {
+		ar.markAbsent(i - ar.firstPageOffset)
+		return nil, fmt.Errorf("%s: %w", url, ErrBounds)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, res.Status)
 	}
-	return "", false
-}
-
-var httpClient = &http.Client{
-	Timeout: time.Second * 10,
-}
 
-func httpGet(reqURL string, headers map[string]string) (*http.Response, error) {
-	req, err := http.NewRequest("GET", reqURL, nil)
+	page, err := pageFromResponse(url, res)
 	if err != nil {
-		return nil, fmt.Errorf("creating request: %v", err)
+		return nil, err
 	}
 
-	for k, v := range headers {
-		req.Header.Set(k, v)
+	ar.markPresent(i - ar.firstPageOffset)
+
+	if ar.cache != nil {
+		if entry, ok := httpcache.NewEntry(url, page.MIMEType, res.Body, res.Header, time.Now()); ok {
+			ar.cachePut(entry)
+		}
 	}
 
-	log.Printf("GET %s", reqURL)
-	res, err := httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("performing request: %v", err)
+	return page, nil
+}
+
+// pageFromResponse returns the image in a successful response
+func pageFromResponse(url string, res *httpResponse) (*Page, error) {
+	page := newPage(url, res.Body)
+	if mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type")); err == nil && strings.HasPrefix(mediaType, "image/") {
+		page.MIMEType = mediaType
 	}
-	if res.StatusCode != http.StatusOK {
-		log.Printf("Got status code: %d %s", res.StatusCode, res.Status)
+	if page.MIMEType == "" {
+		return nil, fmt.Errorf("%s: not an image", url)
 	}
+	return page, nil
+}
 
-	return res, nil
+func (ar *HTTP) requestHeaders() map[string]string {
+	headers := make(map[string]string, len(ar.headers))
+	for k, v := range ar.headers {
+		headers[k] = v
+	}
+	return headers
+}
+
+func (ar *HTTP) cachePut(entry *httpcache.Entry) {
+	if err := ar.cache.Put(entry); err != nil {
+		log.Printf("Couldn't cache %s: %v", entry.URL, err)
+	}
 }
@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	httpMaxAttempts        = 4
+	httpRetryBaseDelay     = 500 * time.Millisecond // Doubled after every failed attempt
+	httpMaxRetryAfter      = 30 * time.Second
+	httpMaxRequestsPerHost = 4
+	httpMinRequestInterval = 100 * time.Millisecond // Between the starts of requests to a host
+)
+
+var httpClient = &http.Client{
+	Timeout: time.Second * 10,
+}
+
+// httpResponse is a response with the body read in full
+type httpResponse struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte
+}
+
+// httpFetch performs a request, retrying with exponential backoff after timeouts, dropped
+// connections, server errors and 429 Too Many Requests. The requests to a single host are limited
+// in number and rate. The response to the last attempt is returned whatever its status
+func httpFetch(ctx context.Context, client *http.Client, method string, reqURL string, headers map[string]string) (*httpResponse, error) {
+	u, err := url.Parse(reqURL)
+	if err != nil {
+		return nil, err
+	}
+	limiter := hostLimiterFor(u.Host)
+
+	delay := httpRetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		res, err := limiter.do(ctx, func() (*httpResponse, error) {
+			return httpRequest(ctx, client, method, reqURL, headers)
+		})
+
+		var reason string
+		wait := delay
+		switch {
+		case err != nil && ctx.Err() == nil && isTransientHTTPError(err):
+			reason = err.Error()
+		case err == nil && (res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests):
+			reason = res.Status
+			if retryAfter, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok {
+				wait = max(wait, min(retryAfter, httpMaxRetryAfter))
+			}
+		}
+		if reason == "" || attempt == httpMaxAttempts {
+			return res, err
+		}
+
+		// Jitter, so that the preloads failing together don't retry together
+		wait += time.Duration(rand.Int63n(int64(wait / 2)))
+		log.Printf("Retrying %s in %v: %s", reqURL, wait.Round(time.Millisecond), reason)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+func httpRequest(ctx context.Context, client *http.Client, method string, reqURL string, headers map[string]string) (*httpResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %v", err)
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	log.Printf("%s %s", method, reqURL)
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("performing request: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		log.Printf("Got status code: %d %s", res.StatusCode, res.Status)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+
+	return &httpResponse{StatusCode: res.StatusCode, Status: res.Status, Header: res.Header, Body: body}, nil
+}
+
+// isTransientHTTPError reports whether a request that failed with err is worth retrying
+func isTransientHTTPError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// parseRetryAfter parses the value of the Retry-After header, given either in seconds or as a date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// hostLimiter bounds the number of concurrent requests to a host and the rate of starting them
+type hostLimiter struct {
+	slots chan struct{}
+	mutex sync.Mutex
+	next  time.Time // The earliest time the next request may start
+}
+
+var (
+	hostLimiters      = make(map[string]*hostLimiter)
+	hostLimitersMutex sync.Mutex
+)
+
+// hostLimiterFor returns the limiter shared by all the requests to host
+func hostLimiterFor(host string) *hostLimiter {
+	hostLimitersMutex.Lock()
+	defer hostLimitersMutex.Unlock()
+	l, ok := hostLimiters[host]
+	if !ok {
+		l = &hostLimiter{slots: make(chan struct{}, httpMaxRequestsPerHost)}
+		hostLimiters[host] = l
+	}
+	return l
+}
+
+// do runs request once there is a free slot and it is its turn
+func (l *hostLimiter) do(ctx context.Context, request func() (*httpResponse, error)) (*httpResponse, error) {
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-l.slots }()
+
+	l.mutex.Lock()
+	start := time.Now()
+	if l.next.After(start) {
+		start = l.next
+	}
+	l.next = start.Add(httpMinRequestInterval)
+	l.mutex.Unlock()
+
+	if wait := time.Until(start); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+	return request()
+}
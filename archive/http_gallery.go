@@ -0,0 +1,242 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// GalleryRule tells how to find the images of a chapter, and the links to the neighboring chapters,
+// in the HTML page of the chapter. Each is found either with a CSS selector of the elements and
+// the attributes holding the URLs, or with a regular expression matched against the HTML, the first
+// subexpression of which, if any, or else the whole match, is the URL
+type GalleryRule struct {
+	Images          string // CSS selector of the images
+	ImagesPattern   string // Regular expression matching the image URLs, used instead of Images
+	ImageAttrs      string // Attributes of the images tried in order, separated by spaces. "src" by default
+	Next            string // CSS selector of the link to the next chapter
+	NextPattern     string // Regular expression matching the URL of the next chapter, used instead of Next
+	Previous        string // CSS selector of the link to the previous chapter
+	PreviousPattern string // Regular expression matching the URL of the previous chapter, used instead of Previous
+	LinkAttrs       string // Attributes of the links tried in order, separated by spaces. "href" by default
+}
+
+// Gallery is what has been found in the HTML page of a chapter
+type Gallery struct {
+	ImageURLs   []string
+	NextURL     string // Empty if there's no link to the next chapter
+	PreviousURL string // Empty if there's no link to the previous chapter
+}
+
+// ScrapeGallery finds what the rule tells to in the HTML page of a chapter, resolving relative URLs
+// against pageURL
+func ScrapeGallery(page []byte, pageURL string, rule GalleryRule) (*Gallery, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return nil, err
+	}
+
+	var gallery Gallery
+	images, err := scrapeURLs(doc, page, rule.Images, rule.ImagesPattern, attrsOrDefault(rule.ImageAttrs, "src"))
+	if err != nil {
+		return nil, fmt.Errorf("images: %v", err)
+	}
+	seen := make(map[string]bool)
+	for _, image := range images {
+		if u, ok := resolveURL(base, image); ok && !seen[u] {
+			seen[u] = true
+			gallery.ImageURLs = append(gallery.ImageURLs, u)
+		}
+	}
+
+	linkAttrs := attrsOrDefault(rule.LinkAttrs, "href")
+	for _, link := range []struct {
+		name             string
+		selector, regexp string
+		url              *string
+	}{
+		{"next chapter", rule.Next, rule.NextPattern, &gallery.NextURL},
+		{"previous chapter", rule.Previous, rule.PreviousPattern, &gallery.PreviousURL},
+	} {
+		urls, err := scrapeURLs(doc, page, link.selector, link.regexp, linkAttrs)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", link.name, err)
+		}
+		for _, u := range urls {
+			if resolved, ok := resolveURL(base, u); ok && resolved != base.String() {
+				*link.url = resolved
+				break
+			}
+		}
+	}
+
+	return &gallery, nil
+}
+
+// scrapeURLs returns the values of the first of the attributes present in the elements matching
+// the selector, or the matches of the pattern, in the order they appear in the page
+func scrapeURLs(doc *html.Node, page []byte, selector, pattern string, attrs []string) ([]string, error) {
+	var urls []string
+	switch {
+	case pattern != "":
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range re.FindAllSubmatch(page, -1) {
+			u := m[0]
+			if len(m) > 1 {
+				u = m[1]
+			}
+			// URLs inside scripts commonly have their slashes escaped
+			urls = append(urls, strings.ReplaceAll(html.UnescapeString(string(u)), `\/`, "/"))
+		}
+	case selector != "":
+		sel, err := cascadia.Parse(selector)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range cascadia.QueryAll(doc, sel) {
+			for _, attr := range attrs {
+				if v := strings.TrimSpace(nodeAttr(n, attr)); v != "" {
+					urls = append(urls, v)
+					break
+				}
+			}
+		}
+	}
+	return urls, nil
+}
+
+func nodeAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func resolveURL(base *url.URL, ref string) (string, bool) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") || strings.HasPrefix(ref, "data:") || strings.HasPrefix(ref, "javascript:") {
+		return "", false
+	}
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", false
+	}
+	return u.String(), true
+}
+
+func attrsOrDefault(attrs string, def string) []string {
+	if fields := strings.Fields(attrs); len(fields) > 0 {
+		return fields
+	}
+	return []string{def}
+}
+
+// galleryProfile returns the HTTP profile with a gallery rule to open the URL with, or nil if the
+// URL is not to be opened as a gallery. That's never the case for URL templates and URLs of images
+func galleryProfile(rawURL string, opts Options) (*HTTPProfile, error) {
+	if IsPageURLTemplate(rawURL) {
+		return nil, nil
+	}
+	if u, err := url.Parse(rawURL); err == nil && IsImagePath(path.Base(u.Path)) {
+		return nil, nil
+	}
+	profile, err := MatchHTTPProfile(opts.HTTPProfiles, rawURL)
+	if err != nil || profile == nil || profile.Gallery == nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// IsHTTPGalleryURL reports whether the URL is to be opened with NewHTTPGallery
+func IsHTTPGalleryURL(rawURL string, opts Options) bool {
+	profile, err := galleryProfile(rawURL, opts)
+	return err == nil && profile != nil
+}
+
+// NewHTTPGallery opens the archive of the images of the chapter whose HTML page is at galleryURL,
+// found according to the gallery rule of the HTTP profile the URL matches. Unless a referer is
+// given, the requests for the images are made with the page as the referer
+func NewHTTPGallery(galleryURL string, opts Options) (*HTTP, error) {
+	profile, err := galleryProfile(galleryURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	if profile == nil {
+		return nil, errors.New("No HTTP profile with a gallery rule matches the URL")
+	}
+	client, headers, err := httpClientForProfile(profile, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ar := &HTTP{
+		galleryURL: galleryURL,
+		client:     client,
+		headers:    headers,
+		cache:      opts.HTTPCache,
+		pages:      make(map[int]*Page),
+		fetches:    make(map[int]*pageFetch),
+	}
+	ar.ctx, ar.cancel = context.WithCancel(context.Background())
+
+	res, err := httpFetch(ar.ctx, client, http.MethodGet, galleryURL, headers)
+	if err == nil && res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("%s: %s", galleryURL, res.Status)
+	}
+	if err == nil {
+		ar.gallery, err = ScrapeGallery(res.Body, galleryURL, *profile.Gallery)
+	}
+	if err == nil && len(ar.gallery.ImageURLs) == 0 {
+		err = fmt.Errorf("No images found in %s", galleryURL)
+	}
+	if err != nil {
+		ar.Close()
+		return nil, err
+	}
+	log.Printf("Found %d images in %s", len(ar.gallery.ImageURLs), galleryURL)
+
+	if _, ok := ar.headers["Referer"]; !ok {
+		ar.headers["Referer"] = galleryURL
+	}
+	n := len(ar.gallery.ImageURLs)
+	ar.bounds = httpBounds{maxPresent: n - 1, minAbsent: n, known: true}
+
+	return ar, nil
+}
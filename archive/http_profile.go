@@ -0,0 +1,203 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package archive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPProfile customizes the requests made for the HTTP archives on the sites it matches
+type HTTPProfile struct {
+	Name        string
+	Hosts       []string          // Matched exactly, or with "*." matching the domain and its subdomains
+	URLPattern  string            // A regular expression matched against the URLs
+	Headers     map[string]string // Extra request headers
+	Referer     string
+	UserAgent   string
+	CookiesFile string       // A Netscape cookies.txt file, as exported by browser extensions
+	Proxy       string       // http://, https://, socks5:// or socks5h:// URL
+	Gallery     *GalleryRule // Where to find the images in the HTML pages of the chapters, if set
+}
+
+// MatchHTTPProfile returns the first of the profiles that matches rawURL, or nil. A profile with
+// neither Hosts nor URLPattern matches any URL
+func MatchHTTPProfile(profiles []HTTPProfile, rawURL string) (*HTTPProfile, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := strings.ToLower(u.Hostname())
+
+	for i := range profiles {
+		p := &profiles[i]
+		matches := len(p.Hosts) == 0 && p.URLPattern == ""
+		for _, h := range p.Hosts {
+			h = strings.ToLower(h)
+			if host == h || (strings.HasPrefix(h, "*.") && (host == h[2:] || strings.HasSuffix(host, h[1:]))) {
+				matches = true
+			}
+		}
+		if p.URLPattern != "" {
+			re, err := regexp.Compile(p.URLPattern)
+			if err != nil {
+				return nil, fmt.Errorf("HTTP profile %q: %v", p.Name, err)
+			}
+			if re.MatchString(rawURL) {
+				matches = true
+			}
+		}
+		if matches {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+// client returns an HTTP client with the profile's cookies and proxy
+func (p *HTTPProfile) client() (*http.Client, error) {
+	if p.CookiesFile == "" && p.Proxy == "" {
+		return httpClient, nil
+	}
+
+	client := *httpClient
+	if p.CookiesFile != "" {
+		jar, err := loadCookiesFile(p.CookiesFile)
+		if err != nil {
+			return nil, fmt.Errorf("HTTP profile %q: loading cookies: %v", p.Name, err)
+		}
+		client.Jar = jar
+	}
+	if p.Proxy != "" {
+		proxyURL, err := url.Parse(p.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("HTTP profile %q: %v", p.Name, err)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(proxyURL)
+		client.Transport = transport
+	}
+	return &client, nil
+}
+
+// headers returns the request headers the profile makes for, with referer taking precedence over
+// the profile's own if not empty
+func (p *HTTPProfile) headers(referer string) map[string]string {
+	headers := map[string]string{"User-Agent": userAgent}
+	if p != nil {
+		for k, v := range p.Headers {
+			headers[k] = v
+		}
+		if p.UserAgent != "" {
+			headers["User-Agent"] = p.UserAgent
+		}
+		if referer == "" {
+			referer = p.Referer
+		}
+	}
+	if referer != "" {
+		headers["Referer"] = referer
+	}
+	return headers
+}
+
+func loadCookiesFile(path string) (http.CookieJar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := readCookiesFile(f, jar, time.Now()); err != nil {
+		return nil, err
+	}
+	return jar, nil
+}
+
+// readCookiesFile adds the unexpired cookies from a Netscape cookies.txt file to jar. Each line
+// of the file has the tab-separated fields: domain, whether the subdomains are included, path,
+// whether the cookie is secure, expiration time (0 for session cookies), name and value. Malformed
+// lines are skipped
+func readCookiesFile(r io.Reader, jar http.CookieJar, now time.Time) error {
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		// Not trimming spaces and tabs, since the value may be empty
+		line := strings.TrimRight(scanner.Text(), "\r\n")
+		// Curl marks HttpOnly cookies with a prefix to what would otherwise be a comment
+		httpOnly := false
+		if rest, ok := strings.CutPrefix(line, "#HttpOnly_"); ok {
+			line, httpOnly = rest, true
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			log.Printf("Skipping line %d of the cookies file: expected 7 tab-separated fields, got %d", lineNo, len(fields))
+			continue
+		}
+		domain, includeSubdomains, path, secure := fields[0], fields[1] == "TRUE", fields[2], fields[3] == "TRUE"
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			log.Printf("Skipping line %d of the cookies file: invalid expiration time: %v", lineNo, err)
+			continue
+		}
+
+		cookie := &http.Cookie{
+			Name:     fields[5],
+			Value:    fields[6],
+			Path:     path,
+			Secure:   secure,
+			HttpOnly: httpOnly,
+		}
+		if expires != 0 {
+			cookie.Expires = time.Unix(expires, 0)
+			if cookie.Expires.Before(now) {
+				continue
+			}
+		}
+		host := strings.TrimPrefix(domain, ".")
+		if includeSubdomains {
+			// Without the domain attribute, the cookie would only be sent to the host itself
+			cookie.Domain = host
+		}
+
+		scheme := "http"
+		if secure {
+			scheme = "https"
+		}
+		jar.SetCookies(&url.URL{Scheme: scheme, Host: host, Path: path}, []*http.Cookie{cookie})
+	}
+	return scanner.Err()
+}
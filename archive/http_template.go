@@ -0,0 +1,245 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// URL templates are inferred from a sample URL of one of the pages by trying each run of digits in
+// it as the page number. Since most of them usually aren't, the candidate templates are checked by
+// requesting the pages next to the sample one
+
+const (
+	maxURLTemplateCandidates = 8
+	maxPageNumberDigits      = 6 // Longer runs of digits are IDs, dates and the like
+
+	// The candidates not verified by then are taken as not followed by the page URLs
+	urlTemplateVerificationTimeout = 20 * time.Second
+)
+
+// URLTemplateCandidate is a template that a sample page URL might follow
+type URLTemplateCandidate struct {
+	Template string
+	Verified bool // Whether a page next to the sample one has been found using the template
+}
+
+// urlTemplateGuess is a template made by taking one of the runs of digits in a sample URL for the
+// page number
+type urlTemplateGuess struct {
+	template string
+	n        int // The page number of the sample URL
+	rank     int // Lower is likelier
+	pos      int
+}
+
+var pagePlaceholderRegexp = regexp.MustCompile(`%\d{0,2}d`)
+
+func IsPageURLTemplate(s string) bool {
+	return pagePlaceholderRegexp.MatchString(s)
+}
+
+// Names of query parameters that commonly hold the page number
+var pageParamNames = map[string]bool{
+	"page": true, "p": true, "pg": true, "pic": true, "img": true, "image": true, "i": true, "n": true,
+}
+
+// InferURLTemplates returns the templates the sample page URL might follow, most likely first. If
+// the page next to the sample one can be found using any of them, only those that it can be found
+// with are returned. There is always at least one unless an error is returned
+func InferURLTemplates(ctx context.Context, sampleURL string, opts Options) ([]URLTemplateCandidate, error) {
+	guesses := guessURLTemplates(sampleURL)
+	if len(guesses) == 0 {
+		return nil, errors.New("Couldn't determine the URL template from the sample URL")
+	}
+
+	client, headers, err := httpClientFor(sampleURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	if client != httpClient {
+		defer client.CloseIdleConnections()
+	}
+
+	sample, err := httpFetch(ctx, client, http.MethodGet, sampleURL, headers)
+	if err != nil {
+		return nil, err
+	}
+	if sample.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", sampleURL, sample.Status)
+	}
+
+	verifyCtx, cancel := context.WithTimeout(ctx, urlTemplateVerificationTimeout)
+	defer cancel()
+	verified := make([]bool, len(guesses))
+	var wg sync.WaitGroup
+	for i, g := range guesses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			verified[i] = verifyURLTemplate(verifyCtx, client, headers, g, sample.Body)
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var candidates, unverified []URLTemplateCandidate
+	for i, g := range guesses {
+		if verified[i] {
+			candidates = append(candidates, URLTemplateCandidate{Template: g.template, Verified: true})
+		} else {
+			unverified = append(unverified, URLTemplateCandidate{Template: g.template})
+		}
+	}
+	if len(candidates) == 0 {
+		log.Printf("Couldn't find any page next to %s", sampleURL)
+		return unverified, nil
+	}
+	return candidates, nil
+}
+
+// verifyURLTemplate checks whether a page next to the sample one can be found using the template.
+// A different image is required, since some parameters, like image sizes, don't make much of a
+// difference to the response
+func verifyURLTemplate(ctx context.Context, client *http.Client, headers map[string]string, g urlTemplateGuess, sampleData []byte) bool {
+	for _, n := range []int{g.n + 1, g.n - 1} {
+		if n < 0 {
+			continue
+		}
+		url := fmt.Sprintf(g.template, n)
+		res, err := httpFetch(ctx, client, http.MethodGet, url, headers)
+		if err != nil || res.StatusCode != http.StatusOK {
+			continue
+		}
+		if _, err := pageFromResponse(url, res); err == nil && !bytes.Equal(res.Body, sampleData) {
+			return true
+		}
+	}
+	return false
+}
+
+// guessURLTemplates returns the templates made by taking each run of digits in the path and the
+// query of the URL for the page number, most likely first. Zero padding is preserved
+func guessURLTemplates(url string) []urlTemplateGuess {
+	start := 0
+	if i := strings.Index(url, "://"); i != -1 {
+		start = i + len("://")
+		// Skip the host
+		if j := strings.IndexAny(url[start:], "/?#"); j != -1 {
+			start += j
+		} else {
+			start = len(url)
+		}
+	}
+	end := len(url)
+	if i := strings.IndexByte(url[start:], '#'); i != -1 {
+		end = start + i
+	}
+	queryStart := end
+	if i := strings.IndexByte(url[start:end], '?'); i != -1 {
+		queryStart = start + i
+	}
+	lastSegmentStart := start + strings.LastIndexByte(url[start:queryStart], '/') + 1
+
+	var guesses []urlTemplateGuess
+	for i := start; i < end; {
+		if url[i] == '%' {
+			// Skip percent-encoded characters
+			i += 3
+			continue
+		}
+		if !isDigit(url[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < end && isDigit(url[j]) {
+			j++
+		}
+		if digits := url[i:j]; len(digits) <= maxPageNumberDigits {
+			g := urlTemplateGuess{
+				template: escapePercent(url[:i]) + pageNumberVerb(digits) + escapePercent(url[j:]),
+				pos:      i,
+			}
+			fmt.Sscanf(digits, "%d", &g.n)
+			switch {
+			case i >= queryStart:
+				g.rank = 1
+				if pageParamNames[strings.ToLower(queryParamName(url[queryStart:i]))] {
+					g.rank = 0
+				}
+			case i >= lastSegmentStart:
+				g.rank = 0
+			default:
+				g.rank = 2
+			}
+			guesses = append(guesses, g)
+		}
+		i = j
+	}
+
+	sort.SliceStable(guesses, func(a, b int) bool {
+		if guesses[a].rank != guesses[b].rank {
+			return guesses[a].rank < guesses[b].rank
+		}
+		return guesses[a].pos > guesses[b].pos
+	})
+	if len(guesses) > maxURLTemplateCandidates {
+		guesses = guesses[:maxURLTemplateCandidates]
+	}
+	return guesses
+}
+
+// pageNumberVerb returns the formatting verb for page numbers written like digits
+func pageNumberVerb(digits string) string {
+	if len(digits) > 1 && digits[0] == '0' {
+		return fmt.Sprintf("%%0%dd", len(digits))
+	}
+	return "%d"
+}
+
+// queryParamName returns the name of the query parameter whose value begins where the given
+// part of the query ends, or "" if it doesn't begin there
+func queryParamName(queryBefore string) string {
+	if !strings.HasSuffix(queryBefore, "=") {
+		return ""
+	}
+	name := strings.TrimSuffix(queryBefore, "=")
+	return name[strings.LastIndexAny(name, "?&;")+1:]
+}
+
+func escapePercent(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,264 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nwaples/rardecode/v2"
+)
+
+// Archives can contain other archives, e.g. when a complete series is distributed as a single zip
+// of per-volume cbz files. An inner archive is addressed with a virtual path made up of the path of
+// its container followed by its name inside the container, e.g. /comics/Series.zip/Series v01.cbz.
+// Inner archives are read without being extracted to disk
+
+var (
+	containerExtensions    = []string{".zip", ".cbz"}
+	nestedVolumeExtensions = []string{".zip", ".cbz", ".rar", ".cbr"}
+)
+
+// SplitNestedPath splits the virtual path of an archive nested in another one into the path of the
+// container and the name of the archive inside it. ok is false for paths that exist on disk
+func SplitNestedPath(p string) (container string, inner string, ok bool) {
+	if _, err := os.Stat(p); err == nil {
+		return "", "", false
+	}
+	for container = filepath.Dir(p); ; container = filepath.Dir(container) {
+		fi, err := os.Stat(container)
+		if err == nil {
+			if !fi.Mode().IsRegular() || !extensionMatches(container, containerExtensions) {
+				return "", "", false
+			}
+			inner, err = filepath.Rel(container, p)
+			if err != nil {
+				return "", "", false
+			}
+			return container, filepath.ToSlash(inner), true
+		}
+		if container == filepath.Dir(container) {
+			return "", "", false
+		}
+	}
+}
+
+// ListNested returns the natsorted names of the archives inside a container archive
+func ListNested(container string) ([]string, error) {
+	reader, err := zip.OpenReader(container)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	names := make([]string, 0)
+	for _, f := range reader.File {
+		if extensionMatches(f.Name, nestedVolumeExtensions) {
+			names = append(names, f.Name)
+		}
+	}
+
+	sort.Sort(filenames(names))
+
+	return names, nil
+}
+
+// FirstNestedVolumePath returns the virtual path of the first archive inside the archive or
+// directory at the given path if it contains no images of its own, but does contain archives.
+// Otherwise the path is returned unchanged
+func FirstNestedVolumePath(p string) string {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return p
+	}
+
+	if fi.IsDir() {
+		if subPath, err := findFirstDirContainingSupportedImage(p); err != nil || subPath != nil {
+			return p
+		}
+		names, err := ListInDirectory(p)
+		if err != nil {
+			return p
+		}
+		for _, name := range names {
+			if extensionMatches(name, archiveExtensions) || isSevenZipVolume(name) {
+				return filepath.Join(p, name)
+			}
+		}
+		return p
+	}
+
+	if !extensionMatches(p, containerExtensions) {
+		return p
+	}
+	reader, err := zip.OpenReader(p)
+	if err != nil {
+		return p
+	}
+	defer reader.Close()
+	var first string
+	for _, f := range reader.File {
+		if extensionMatches(f.Name, imageExtensions) {
+			return p
+		}
+		if extensionMatches(f.Name, nestedVolumeExtensions) && (first == "" || strcmp(f.Name, first, true)) {
+			first = f.Name
+		}
+	}
+	if first == "" {
+		return p
+	}
+	return filepath.Join(p, filepath.FromSlash(first))
+}
+
+// NewNested opens an archive nested inside a container archive. If the inner archive is stored
+// uncompressed, it's read directly from the container file; otherwise it's decompressed into memory
+func NewNested(container string, inner string, password string) (Archive, error) {
+	reader, err := zip.OpenReader(container)
+	if err != nil {
+		return nil, err
+	}
+
+	var innerFile *zip.File
+	for _, f := range reader.File {
+		if f.Name == inner {
+			innerFile = f
+			break
+		}
+	}
+	if innerFile == nil {
+		reader.Close()
+		return nil, fmt.Errorf("%s not found in %s", inner, filepath.Base(container))
+	}
+
+	data, err := openNestedData(container, innerFile)
+	// The container's directory isn't needed anymore
+	reader.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	name := path.Base(inner)
+	switch strings.ToLower(path.Ext(name)) {
+	case ".zip", ".cbz":
+		return newZip(name, data, data.Size(), data, password)
+	case ".rar", ".cbr":
+		ar, err := newRar(name, password, rardecode.FileSystem(nestedFS{name: name, data: data}))
+		if err != nil {
+			data.Close()
+			return nil, err
+		}
+		ar.closer = data
+		return ar, nil
+	}
+
+	data.Close()
+	return nil, errors.New("Unknown archive type")
+}
+
+// nestedData is the contents of an archive nested in another one
+type nestedData struct {
+	*io.SectionReader
+	file *os.File // The container file, if the contents are read directly from it
+}
+
+func (d *nestedData) Close() error {
+	if d.file != nil {
+		return d.file.Close()
+	}
+	return nil
+}
+
+func openNestedData(container string, f *zip.File) (*nestedData, error) {
+	if f.Flags&zipEncryptedFlag != 0 {
+		return nil, fmt.Errorf("%s: encrypted archives inside other archives are not supported", f.Name)
+	}
+
+	if f.Method == zip.Store {
+		offset, err := f.DataOffset()
+		if err != nil {
+			return nil, err
+		}
+		file, err := os.Open(container)
+		if err != nil {
+			return nil, err
+		}
+		return &nestedData{io.NewSectionReader(file, offset, int64(f.UncompressedSize64)), file}, nil
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	buf, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	return &nestedData{io.NewSectionReader(bytes.NewReader(buf), 0, int64(len(buf))), nil}, nil
+}
+
+// nestedFS is a filesystem consisting of a single nested archive, for decoders that open archives
+// by name
+type nestedFS struct {
+	name string
+	data *nestedData
+}
+
+func (fsys nestedFS) Open(name string) (fs.File, error) {
+	if name != fsys.name {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	// Every opened file needs its own read position
+	return &nestedFile{io.NewSectionReader(fsys.data, 0, fsys.data.Size()), fsys.name}, nil
+}
+
+type nestedFile struct {
+	*io.SectionReader
+	name string
+}
+
+func (f *nestedFile) Stat() (fs.FileInfo, error) {
+	return nestedFileInfo{f}, nil
+}
+
+func (f *nestedFile) Close() error {
+	return nil
+}
+
+type nestedFileInfo struct {
+	f *nestedFile
+}
+
+func (fi nestedFileInfo) Name() string       { return fi.f.name }
+func (fi nestedFileInfo) Size() int64        { return fi.f.Size() }
+func (fi nestedFileInfo) Mode() fs.FileMode  { return 0444 }
+func (fi nestedFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi nestedFileInfo) IsDir() bool        { return false }
+func (fi nestedFileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package archive
+
+import (
+	"bytes"
+	"context"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+)
+
+// Page is the encoded image of a page. Decoding it is up to the user of the archive
+type Page struct {
+	Data     []byte
+	MIMEType string // Empty if it could not be determined
+}
+
+func newPage(name string, data []byte) *Page {
+	return &Page{Data: data, MIMEType: detectMIMEType(name, data)}
+}
+
+// readPage reads the image named name from r, giving up once ctx is done
+func readPage(ctx context.Context, name string, r io.Reader) (*Page, error) {
+	data, err := io.ReadAll(ctxReader{ctx, r})
+	if err != nil {
+		return nil, err
+	}
+	return newPage(name, data), nil
+}
+
+// ctxReader reads from r until ctx is done
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// detectMIMEType guesses the type of an image from its contents, or failing that, from its name
+func detectMIMEType(name string, data []byte) string {
+	if t := http.DetectContentType(data); strings.HasPrefix(t, "image/") {
+		return t
+	}
+	if t := mime.TypeByExtension(strings.ToLower(filepath.Ext(name))); strings.HasPrefix(t, "image/") {
+		return t
+	}
+	return ""
+}
+
+// Decode decodes the page with the decoders registered with the image package. Those for JPEG,
+// PNG, GIF and WebP always are
+func (p *Page) Decode() (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(p.Data))
+	return img, err
+}
+
+// DecodeConfig returns the dimensions of the page without decoding all of it, as long as there
+// is a decoder for its format registered with the image package
+func (p *Page) DecodeConfig() (image.Config, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(p.Data))
+	return config, err
+}
@@ -19,68 +19,125 @@
 package archive
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"os"
 	"path/filepath"
 	"sort"
+	"sync"
 
-	"github.com/fauu/gomicsv/pixbuf"
-	"github.com/gotk3/gotk3/gdk"
 	"github.com/nwaples/rardecode/v2"
 )
 
+// Rar provides access to the images inside a rar archive without rescanning the archive from
+// the beginning for every page.
+//
+// Solid archives can only be decoded sequentially, so their images are extracted once, in archive
+// order, into a temporary file by a background goroutine started when the archive is opened.
+// Loading a page that hasn't been extracted yet waits for the extraction to reach it.
+//
+// Non-solid archives are read through a reusable reader that is advanced forward to the requested
+// file, so that reading pages sequentially costs roughly the same for every page. Pages behind the
+// reader are opened directly instead.
 type Rar struct {
 	files  RarMembers // Sorted by name
-	reader *rardecode.ReadCloser
+	path   string
 	name   string
+	solid  bool
+	opts   []rardecode.Option
+	closer io.Closer // Underlying file of an archive nested in another one
+
+	cursor      *rarCursor // Non-solid archives only
+	cursorMutex sync.Mutex
+
+	extractDone chan struct{} // Solid archives only. Closed to stop the extraction
+	extractWG   sync.WaitGroup
+	extractErr  error
+	spool       *os.File // Solid archives only. The extracted images, removed on Close
+
+	closeOnce sync.Once
+	closeErr  error
+
+	// ComicInfo.xml is read when opening the archive, unless it would require decoding images of
+	// a solid archive first. In that case it's picked up by the extraction
+	comicInfoMember  *RarMember
+	comicInfoPending bool // Whether to leave comicInfoMember to the extraction
+	comicInfoOnce    sync.Once
+	comicInfo        *ComicInfo
 }
 
 type RarMember struct {
-	Header *rardecode.FileHeader
+	File   *rardecode.File
 	Offset int // in terms of files
+
+	data        []byte        // Contents, for ComicInfo.xml only
+	spoolOffset int64         // Where the image extracted from a solid archive is in the spool
+	size        int64         // Size of the extracted image. -1 if it hasn't been extracted
+	ready       chan struct{} // Closed once the member is extracted or the extraction has stopped
 }
 
-type RarMembers []RarMember
+type RarMembers []*RarMember
 
 func (p RarMembers) Len() int           { return len(p) }
-func (p RarMembers) Less(i, j int) bool { return strcmp(p[i].Header.Name, p[j].Header.Name, true) }
+func (p RarMembers) Less(i, j int) bool { return strcmp(p[i].File.Name, p[j].File.Name, true) }
 func (p RarMembers) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
-// NewRar reads supported image filenames from a given rar archive and sorts them
-func NewRar(name string) (*Rar, error) {
-	var err error
+// rarCursor is a sequential reader over the archive together with the offset of the file it is
+// currently positioned at
+type rarCursor struct {
+	reader *rardecode.ReadCloser
+	offset int
+}
 
-	ar := new(Rar)
+// NewRar reads supported image filenames from a given rar archive and sorts them. If path is the
+// first volume of a multi-volume set, the subsequent volumes are read as well. password is only
+// used if the archive is encrypted
+func NewRar(path string, password string) (*Rar, error) {
+	return newRar(path, password)
+}
 
-	ar.name = filepath.Base(name)
-	ar.files = make([]RarMember, 0, MaxArchiveEntries)
-	ar.reader, err = rardecode.OpenReader(name)
-	if err != nil {
-		return nil, err
+// newRar is NewRar with additional options for the decoder, such as the filesystem to read the
+// archive from
+func newRar(path string, password string, opts ...rardecode.Option) (*Rar, error) {
+	ar := &Rar{
+		path: path,
+		name: filepath.Base(path),
+		opts: opts,
+	}
+	if password != "" {
+		ar.opts = append(ar.opts, rardecode.Password(password))
 	}
 
-	offsetAcc := -1
-	for {
-		offsetAcc += 1
+	list, err := rardecode.List(path, ar.opts...)
+	if err != nil {
+		return nil, rarPasswordError(err, password)
+	}
 
-		header, err := ar.reader.Next()
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			log.Printf("error reading a file inside the rar archive: %v", err)
-		}
-		if header.IsDir {
+	encrypted := false
+	ar.files = make(RarMembers, 0, len(list))
+	for offset, f := range list {
+		if !f.IsDir && isComicInfo(f.Name) {
+			ar.comicInfoMember = &RarMember{File: f, Offset: offset, ready: make(chan struct{})}
 			continue
 		}
-		if !extensionMatches(header.Name, imageExtensions) {
+		if f.IsDir || !extensionMatches(f.Name, imageExtensions) {
 			continue
 		}
-		ar.files = append(ar.files, RarMember{
-			Header: header,
-			Offset: offsetAcc,
+		if f.Solid {
+			ar.solid = true
+		}
+		if f.Encrypted {
+			encrypted = true
+		}
+		ar.files = append(ar.files, &RarMember{
+			File:   f,
+			Offset: offset,
+			size:   -1,
+			ready:  make(chan struct{}),
 		})
 	}
 
@@ -88,13 +145,151 @@ func NewRar(name string) (*Rar, error) {
 		return nil, errors.New(ar.name + ": no supported images in the rar file")
 	}
 
-	sort.Sort(RarMembers(ar.files))
+	if encrypted {
+		if password == "" {
+			return nil, ErrPasswordRequired
+		}
+		if err := ar.verifyPassword(); err != nil {
+			return nil, rarPasswordError(err, password)
+		}
+	}
+
+	if m := ar.comicInfoMember; m != nil {
+		if ar.solid && m.Offset > ar.files[0].Offset {
+			ar.comicInfoPending = true
+		} else {
+			if m.data, err = readRarFile(m.File); err != nil {
+				log.Printf("Error reading %s from %s: %v", ComicInfoFilename, ar.name, err)
+			}
+			close(m.ready)
+		}
+	}
+
+	// Before extraction starts reading the files
+	sort.Sort(ar.files)
 
-	ar.Close()
+	if ar.solid {
+		if ar.spool, err = os.CreateTemp("", "gomicsv-rar-*"); err != nil {
+			return nil, fmt.Errorf("creating temporary file: %v", err)
+		}
+		ar.extractDone = make(chan struct{})
+		ar.extractWG.Add(1)
+		go ar.extractSolid()
+	}
 
 	return ar, nil
 }
 
+// verifyPassword decodes the first encrypted file in the archive, since not every version of the
+// format allows to verify the password upfront
+func (ar *Rar) verifyPassword() error {
+	reader, err := rardecode.OpenReader(ar.path, ar.opts...)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for {
+		header, err := reader.Next()
+		if err != nil {
+			return err
+		}
+		if header.IsDir || !header.Encrypted {
+			continue
+		}
+		_, err = io.Copy(io.Discard, reader)
+		return err
+	}
+}
+
+func rarPasswordError(err error, password string) error {
+	switch {
+	case errors.Is(err, rardecode.ErrArchiveEncrypted), errors.Is(err, rardecode.ErrArchivedFileEncrypted):
+		return ErrPasswordRequired
+	case errors.Is(err, rardecode.ErrBadPassword):
+		return ErrBadPassword
+	case password != "" && (errors.Is(err, rardecode.ErrBadHeaderCRC) || errors.Is(err, rardecode.ErrBadFileChecksum)):
+		// Older versions of the format don't store a password check value, so the wrong password
+		// only manifests itself as corrupted data
+		return ErrBadPassword
+	}
+	return err
+}
+
+// extractSolid decodes the whole archive once, writing the contents of the image files to the
+// spool. They aren't handed to the page cache instead, since the cache evicts pages, and getting
+// back an evicted page of a solid archive would mean decoding it from the start again
+func (ar *Rar) extractSolid() {
+	defer ar.extractWG.Done()
+
+	// Some or all of the ready channels remain open if we stop early
+	byOffset := make(map[int]*RarMember, len(ar.files)+1)
+	for _, m := range ar.files {
+		byOffset[m.Offset] = m
+	}
+	if ar.comicInfoPending {
+		byOffset[ar.comicInfoMember.Offset] = ar.comicInfoMember
+	}
+	defer func() {
+		for _, m := range byOffset {
+			close(m.ready)
+		}
+	}()
+
+	reader, err := rardecode.OpenReader(ar.path, ar.opts...)
+	if err != nil {
+		ar.extractErr = err
+		return
+	}
+	defer reader.Close()
+
+	spool := &countingWriter{w: ar.spool}
+	for offset := 0; len(byOffset) > 0; offset++ {
+		select {
+		case <-ar.extractDone:
+			ar.extractErr = errors.New("archive closed")
+			return
+		default:
+		}
+
+		if _, err := reader.Next(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			ar.extractErr = fmt.Errorf("extracting files from the rar archive: %v", err)
+			return
+		}
+
+		m, ok := byOffset[offset]
+		if !ok {
+			continue
+		}
+		if m == ar.comicInfoMember {
+			m.data, err = io.ReadAll(reader)
+		} else {
+			start := spool.n
+			if _, err = io.Copy(spool, reader); err == nil {
+				m.spoolOffset, m.size = start, spool.n-start
+			}
+		}
+		if err != nil {
+			ar.extractErr = fmt.Errorf("extracting %s: %v", m.File.Name, err)
+			return
+		}
+		delete(byOffset, offset)
+		close(m.ready)
+	}
+}
+
+func readRarFile(f *rardecode.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
 func (ar *Rar) checkbounds(i int) error {
 	if i < 0 || i >= len(ar.files) {
 		return ErrBounds
@@ -102,39 +297,79 @@ func (ar *Rar) checkbounds(i int) error {
 	return nil
 }
 
-func (ar *Rar) Load(i int, autorotate bool, _nPreload int) (*gdk.Pixbuf, error) {
-	var err error
-	if err = ar.checkbounds(i); err != nil {
+func (ar *Rar) Load(ctx context.Context, i int, _nPreload int) (*Page, error) {
+	if err := ar.checkbounds(i); err != nil {
 		return nil, err
 	}
 
-	ar.reader, err = rardecode.OpenReader(ar.name)
-	if err != nil {
-		return nil, err
+	if !ar.solid {
+		return ar.loadNonSolid(ctx, ar.files[i])
 	}
 
-	targetOffset := ar.files[i].Offset
-	offsetAcc := -1
-	for {
-		offsetAcc += 1
+	m := ar.files[i]
+	select {
+	case <-m.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if m.size == -1 {
+		return nil, ar.extractErr
+	}
+	return readPage(ctx, m.File.Name, io.NewSectionReader(ar.spool, m.spoolOffset, m.size))
+}
+
+func (ar *Rar) loadNonSolid(ctx context.Context, m *RarMember) (*Page, error) {
+	ar.cursorMutex.Lock()
+	defer ar.cursorMutex.Unlock()
 
-		header, err := ar.reader.Next()
+	if ar.cursor != nil && ar.cursor.offset >= m.Offset {
+		// Behind the reader, open directly
+		f, err := m.File.Open()
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			log.Printf("error reading a file inside the rar archive: %v", err)
+			return nil, err
 		}
-		if header.IsDir {
-			continue
+		defer f.Close()
+		return readPage(ctx, m.File.Name, f)
+	}
+
+	if ar.cursor == nil {
+		reader, err := rardecode.OpenReader(ar.path, ar.opts...)
+		if err != nil {
+			return nil, err
 		}
-		if offsetAcc == targetOffset {
-			defer ar.Close()
-			return pixbuf.Load(ar.reader, autorotate)
+		ar.cursor = &rarCursor{reader: reader, offset: -1}
+	}
+
+	for ar.cursor.offset < m.Offset {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if _, err := ar.cursor.reader.Next(); err != nil {
+			ar.closeCursor()
+			if err == io.EOF {
+				return nil, fmt.Errorf("%s: could not find a file inside the rar archive", ar.name)
+			}
+			return nil, err
 		}
+		ar.cursor.offset++
 	}
 
-	return nil, fmt.Errorf("%s: could not find a file inside the rar archive", ar.name)
+	page, err := readPage(ctx, m.File.Name, ar.cursor.reader)
+	if err != nil {
+		// The reader may be left in an inconsistent state
+		ar.closeCursor()
+	}
+	return page, err
+}
+
+func (ar *Rar) closeCursor() {
+	if ar.cursor == nil {
+		return
+	}
+	if err := ar.cursor.reader.Close(); err != nil {
+		log.Printf("Error closing rar reader: %v", err)
+	}
+	ar.cursor = nil
 }
 
 func (ar *Rar) Kind() Kind {
@@ -149,7 +384,7 @@ func (ar *Rar) Name(i int) (string, error) {
 	if err := ar.checkbounds(i); err != nil {
 		return "", err
 	}
-	return ar.files[i].Header.Name, nil
+	return ar.files[i].File.Name, nil
 }
 
 func (ar *Rar) Len() *int {
@@ -157,6 +392,69 @@ func (ar *Rar) Len() *int {
 	return &l
 }
 
+// Metadata returns the contents of the archive's ComicInfo.xml. For some solid archives, it only
+// becomes available once the extraction reaches it
+func (ar *Rar) Metadata() *ComicInfo {
+	m := ar.comicInfoMember
+	if m == nil {
+		return nil
+	}
+	select {
+	case <-m.ready:
+	default:
+		return nil
+	}
+
+	ar.comicInfoOnce.Do(func() {
+		if m.data == nil {
+			return
+		}
+		var err error
+		if ar.comicInfo, err = ParseComicInfo(bytes.NewReader(m.data)); err != nil {
+			log.Printf("Error reading %s from %s: %v", ComicInfoFilename, ar.name, err)
+		}
+	})
+	return ar.comicInfo
+}
+
+func (ar *Rar) OnMetadataKnown(notify func()) {
+	m := ar.comicInfoMember
+	if m == nil {
+		notify()
+		return
+	}
+	go func() {
+		<-m.ready
+		notify()
+	}()
+}
+
 func (ar *Rar) Close() error {
-	return ar.reader.Close()
+	ar.closeOnce.Do(func() {
+		ar.closeErr = ar.close()
+	})
+	return ar.closeErr
+}
+
+func (ar *Rar) close() error {
+	var err error
+	if ar.solid {
+		close(ar.extractDone)
+		ar.extractWG.Wait()
+		err = ar.spool.Close()
+		if rmErr := os.Remove(ar.spool.Name()); rmErr != nil && err == nil {
+			err = rmErr
+		}
+	}
+
+	ar.cursorMutex.Lock()
+	defer ar.cursorMutex.Unlock()
+	ar.closeCursor()
+
+	if ar.closer != nil {
+		if closeErr := ar.closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
 }
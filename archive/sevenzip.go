@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package archive
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"github.com/bodgit/sevenzip"
+)
+
+type SevenZip struct {
+	files  []*sevenzip.File // File elements sorted by their Names
+	reader *sevenzip.ReadCloser
+	name   string // Name of the 7z file
+}
+
+type sevenZipFile []*sevenzip.File
+
+func (p sevenZipFile) Len() int           { return len(p) }
+func (p sevenZipFile) Less(i, j int) bool { return strcmp(p[i].Name, p[j].Name, true) }
+func (p sevenZipFile) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// NewSevenZip reads filenames from a given 7z archive and sorts them. If name is the first volume
+// of a multi-volume set (name.7z.001), the subsequent volumes are opened as well. password is only
+// used if the archive is encrypted
+func NewSevenZip(name string, password string) (*SevenZip, error) {
+	var err error
+
+	ar := new(SevenZip)
+
+	ar.name = filepath.Base(name)
+	ar.files = make([]*sevenzip.File, 0, MaxArchiveEntries)
+	if password == "" {
+		ar.reader, err = sevenzip.OpenReader(name)
+	} else {
+		ar.reader, err = sevenzip.OpenReaderWithPassword(name, password)
+	}
+	if err != nil {
+		return nil, sevenZipPasswordError(err, password)
+	}
+
+	for _, f := range ar.reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if !extensionMatches(f.Name, imageExtensions) {
+			continue
+		}
+		ar.files = append(ar.files, f)
+	}
+
+	if len(ar.files) == 0 {
+		ar.reader.Close()
+		return nil, errors.New(ar.name + ": no images in the 7z file")
+	}
+
+	sort.Sort(sevenZipFile(ar.files))
+
+	// File contents can be encrypted even when the headers are not, which only surfaces once
+	// something is read
+	if err := ar.probe(); err != nil {
+		ar.reader.Close()
+		return nil, sevenZipPasswordError(err, password)
+	}
+
+	return ar, nil
+}
+
+func (ar *SevenZip) probe() error {
+	f, err := ar.files[0].Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.ReadFull(f, make([]byte, 1))
+	if err == io.EOF {
+		// Empty file
+		err = nil
+	}
+	return err
+}
+
+func sevenZipPasswordError(err error, password string) error {
+	encrypted := false
+	var readErr sevenzip.ReadError
+	var readErrPtr *sevenzip.ReadError
+	if errors.As(err, &readErr) {
+		encrypted = readErr.Encrypted
+	} else if errors.As(err, &readErrPtr) {
+		encrypted = readErrPtr.Encrypted
+	}
+	if !encrypted {
+		return err
+	}
+	if password == "" {
+		return ErrPasswordRequired
+	}
+	return ErrBadPassword
+}
+
+func (ar *SevenZip) checkbounds(i int) error {
+	if i < 0 || i >= len(ar.files) {
+		return ErrBounds
+	}
+	return nil
+}
+
+func (ar *SevenZip) Load(ctx context.Context, i int, _nPreload int) (*Page, error) {
+	if err := ar.checkbounds(i); err != nil {
+		return nil, err
+	}
+
+	f, err := ar.files[i].Open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	return readPage(ctx, ar.files[i].Name, f)
+}
+
+func (ar *SevenZip) Kind() Kind {
+	return Packed
+}
+
+func (ar *SevenZip) ArchiveName() string {
+	return ar.name
+}
+
+func (ar *SevenZip) Name(i int) (string, error) {
+	if err := ar.checkbounds(i); err != nil {
+		return "", err
+	}
+
+	return ar.files[i].Name, nil
+}
+
+func (ar *SevenZip) Len() *int {
+	l := len(ar.files)
+	return &l
+}
+
+func (ar *SevenZip) Close() error {
+	return ar.reader.Close()
+}
@@ -0,0 +1,223 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ulikunitz/xz"
+)
+
+type Tar struct {
+	members tarMembers // Sorted by name
+	data    *os.File   // Either the archive itself or a decompressed copy of it
+	spooled bool       // Whether data is a temporary decompressed copy to be removed on Close
+	name    string
+}
+
+type tarMember struct {
+	name   string
+	offset int64 // Offset of the member's contents within data
+	size   int64
+}
+
+type tarMembers []tarMember
+
+func (p tarMembers) Len() int           { return len(p) }
+func (p tarMembers) Less(i, j int) bool { return strcmp(p[i].name, p[j].name, true) }
+func (p tarMembers) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// NewTar indexes the supported images inside a given tar archive, which may be compressed with
+// gzip, bzip2 or xz. Since compressed streams can't be seeked, they are decompressed once into a
+// temporary file, so that any page can be accessed directly afterwards
+func NewTar(name string) (*Tar, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ar := &Tar{name: filepath.Base(name)}
+
+	decompressed, err := tarDecompressedReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if decompressed == nil {
+		ar.data = f
+		ar.members, err = indexTar(f, func() (int64, error) {
+			return f.Seek(0, io.SeekCurrent)
+		})
+	} else {
+		defer f.Close()
+		ar.data, err = os.CreateTemp("", "gomicsv-tar-*")
+		if err != nil {
+			return nil, fmt.Errorf("creating temporary file: %v", err)
+		}
+		ar.spooled = true
+		spool := &countingWriter{w: ar.data}
+		ar.members, err = indexTar(io.TeeReader(decompressed, spool), func() (int64, error) {
+			return spool.n, nil
+		})
+	}
+	if err != nil {
+		ar.Close()
+		return nil, err
+	}
+
+	if len(ar.members) == 0 {
+		ar.Close()
+		return nil, errors.New(ar.name + ": no images in the tar file")
+	}
+
+	sort.Sort(ar.members)
+
+	return ar, nil
+}
+
+// tarDecompressedReader returns a decompressing reader for f if its contents are compressed in
+// one of the supported formats, or nil otherwise
+func tarDecompressedReader(f *os.File) (io.Reader, error) {
+	magic := make([]byte, len(xzMagic))
+	n, err := f.ReadAt(magic, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	magic = magic[:n]
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(f)
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return bzip2.NewReader(f), nil
+	case bytes.HasPrefix(magic, xzMagic):
+		return xz.NewReader(f)
+	}
+	return nil, nil
+}
+
+// indexTar reads the tar stream from r, recording the location of each supported image. pos must
+// report the position in the data file corresponding to the current position of r
+func indexTar(r io.Reader, pos func() (int64, error)) (tarMembers, error) {
+	members := make(tarMembers, 0)
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading tar header: %v", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if !extensionMatches(header.Name, imageExtensions) {
+			continue
+		}
+		offset, err := pos()
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, tarMember{
+			name:   header.Name,
+			offset: offset,
+			size:   header.Size,
+		})
+	}
+	return members, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func (ar *Tar) checkbounds(i int) error {
+	if i < 0 || i >= len(ar.members) {
+		return ErrBounds
+	}
+	return nil
+}
+
+func (ar *Tar) Load(ctx context.Context, i int, _nPreload int) (*Page, error) {
+	if err := ar.checkbounds(i); err != nil {
+		return nil, err
+	}
+
+	m := ar.members[i]
+	return readPage(ctx, m.name, io.NewSectionReader(ar.data, m.offset, m.size))
+}
+
+func (ar *Tar) Kind() Kind {
+	return Packed
+}
+
+func (ar *Tar) ArchiveName() string {
+	return ar.name
+}
+
+func (ar *Tar) Name(i int) (string, error) {
+	if err := ar.checkbounds(i); err != nil {
+		return "", err
+	}
+
+	return ar.members[i].name, nil
+}
+
+func (ar *Tar) Len() *int {
+	l := len(ar.members)
+	return &l
+}
+
+func (ar *Tar) Close() error {
+	if ar.data == nil {
+		return nil
+	}
+	err := ar.data.Close()
+	if ar.spooled {
+		if rmErr := os.Remove(ar.data.Name()); rmErr != nil && err == nil {
+			err = rmErr
+		}
+	}
+	return err
+}
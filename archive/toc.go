@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package archive
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// An archive's table of contents comes, in order of preference, from:
+//   - the navigation document (EPUB only),
+//   - the page bookmarks in ComicInfo.xml,
+//   - the directories the images are grouped in, if there's more than one.
+
+// findChapters determines the chapters of an archive that has no navigation document
+func findChapters(ar Archive, ci *ComicInfo) []Chapter {
+	if chapters := chaptersFromMetadata(ci); len(chapters) > 0 {
+		return chapters
+	}
+	return chaptersFromDirs(ar)
+}
+
+// chaptersFromMetadata makes a chapter out of every bookmarked page in ComicInfo.xml
+func chaptersFromMetadata(ci *ComicInfo) []Chapter {
+	if ci == nil {
+		return nil
+	}
+	var chapters []Chapter
+	for _, page := range ci.Pages {
+		if page.Bookmark != "" {
+			chapters = append(chapters, Chapter{Title: page.Bookmark, Start: page.Image})
+		}
+	}
+	sort.SliceStable(chapters, func(i, j int) bool { return chapters[i].Start < chapters[j].Start })
+	return chapters
+}
+
+// chaptersFromDirs makes a chapter out of every run of consecutive pages from the same directory.
+// Archives with all the pages in a single directory have no chapters
+func chaptersFromDirs(ar Archive) []Chapter {
+	if ar.Len() == nil {
+		return nil
+	}
+
+	var chapters []Chapter
+	for i := 0; i < *ar.Len(); i++ {
+		name, err := ar.Name(i)
+		if err != nil {
+			return nil
+		}
+		dir := path.Dir(filepath.ToSlash(name))
+		if len(chapters) == 0 || chapters[len(chapters)-1].Title != dir {
+			chapters = append(chapters, Chapter{Title: dir, Start: i})
+		}
+	}
+	if len(chapters) < 2 {
+		return nil
+	}
+	return chapters
+}
+
+// ChapterIndexAt returns the index of the chapter that page i belongs to, or -1 if it precedes all
+// the chapters. The chapters must be ordered by their starting pages
+func ChapterIndexAt(chapters []Chapter, i int) int {
+	idx := -1
+	for j := range chapters {
+		if chapters[j].Start > i {
+			break
+		}
+		idx = j
+	}
+	return idx
+}
+
+func (ar *Zip) Chapters() []Chapter {
+	return findChapters(ar, ar.comicInfo)
+}
+
+func (ar *Rar) Chapters() []Chapter {
+	return findChapters(ar, ar.Metadata())
+}
+
+func (ar *Dir) Chapters() []Chapter {
+	return findChapters(ar, ar.comicInfo)
+}
+
+func (ar *SevenZip) Chapters() []Chapter {
+	return findChapters(ar, nil)
+}
+
+func (ar *Tar) Chapters() []Chapter {
+	return findChapters(ar, nil)
+}
@@ -26,42 +26,44 @@ import (
 	"sort"
 	"strings"
 
-	"github.com/gotk3/gotk3/gdk"
-
 	"github.com/fauu/gomicsv/natsort"
 )
 
-type Loader interface {
-	Load(i int) (*gdk.Pixbuf, error)
-	Name(i int) (string, error)
-	Len() int
+var archiveExtensions = []string{
+	".zip", ".cbz", ".rar", ".cbr", ".7z", ".cb7", ".tar", ".cbt", ".tgz", ".tbz", ".tbz2", ".txz",
+	".tar.gz", ".tar.bz2", ".tar.xz", ".epub",
 }
 
-var archiveExtensions = []string{".zip", ".cbz", ".rar"}
-var imageExtensions []string
-
-func init() {
-	imageExtensions = make([]string, 0)
-	formats := gdk.PixbufGetFormats()
-	for _, format := range formats {
-		imageExtensions = append(imageExtensions, format.GetExtensions()...)
-	}
+// Extensions of the image files included in archives. Can be replaced with SetImageExtensions
+var imageExtensions = []string{".jpg", ".jpeg", ".jpe", ".png", ".gif", ".webp", ".bmp", ".tif", ".tiff"}
 
-	for i := range imageExtensions {
-		imageExtensions[i] = "." + imageExtensions[i] // gdk pixbuf format extensions don't have the leading "."
+// SetImageExtensions replaces the extensions (without the leading ".") of the image files that are
+// included in archives, e.g. with those of the formats the user of the archives can decode. Must be
+// called before opening any archives
+func SetImageExtensions(extensions []string) {
+	imageExtensions = make([]string, len(extensions))
+	for i, ext := range extensions {
+		imageExtensions[i] = "." + strings.ToLower(ext)
 	}
 }
 
+// extensionMatches reports whether p ends with one of the extensions, which can consist of more
+// than one part, like ".tar.gz"
 func extensionMatches(p string, extensions []string) bool {
-	pext := strings.ToLower(filepath.Ext(p))
+	p = strings.ToLower(filepath.Base(p))
 	for _, ext := range extensions {
-		if pext == ext {
+		if strings.HasSuffix(p, ext) && len(p) > len(ext) {
 			return true
 		}
 	}
 	return false
 }
 
+// IsImagePath reports whether the given path has the extension of a supported image format
+func IsImagePath(p string) bool {
+	return extensionMatches(p, imageExtensions)
+}
+
 type stringArray []string
 
 func (p stringArray) Len() int           { return len(p) }
@@ -98,9 +100,15 @@ func ListInDirectory(dir string) (anames []string, err error) {
 			return
 		}
 
-		if !extensionMatches(name, archiveExtensions) && !fi.IsDir() {
-			// TODO(utkan): Don't add empty archives
-			continue
+		if !fi.IsDir() {
+			if !extensionMatches(name, archiveExtensions) && !isSevenZipVolume(name) {
+				// TODO(utkan): Don't add empty archives
+				continue
+			}
+			if isSubsequentVolume(name) {
+				// Only the first volume represents a multi-volume archive
+				continue
+			}
 		}
 		anames = append(anames, name)
 	}
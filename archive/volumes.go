@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package archive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+// Naming schemes of multi-volume archives. In each, the first group is the name shared by the
+// whole set and the second identifies the volume
+var (
+	rarPartVolumeRegexp     = regexp.MustCompile(`(?i)^(.+)\.part(\d+)\.rar$`) // name.part1.rar, name.part2.rar, …
+	rarOldStyleVolumeRegexp = regexp.MustCompile(`(?i)^(.+)\.(r\d\d)$`)        // name.rar, name.r00, name.r01, …
+	sevenZipVolumeRegexp    = regexp.MustCompile(`(?i)^(.+\.7z)\.(\d{3})$`)    // name.7z.001, name.7z.002, …
+)
+
+// FirstVolumePath returns the path of the first volume of the multi-volume archive set that the
+// given path belongs to. Other paths, as well as paths whose first volume doesn't exist, are
+// returned unchanged
+func FirstVolumePath(path string) string {
+	dir, name := filepath.Split(path)
+
+	var first string
+	if m := rarPartVolumeRegexp.FindStringSubmatch(name); m != nil {
+		first = fmt.Sprintf("%s.part%0*d.rar", m[1], len(m[2]), 1)
+	} else if m := rarOldStyleVolumeRegexp.FindStringSubmatch(name); m != nil {
+		first = m[1] + ".rar"
+	} else if m := sevenZipVolumeRegexp.FindStringSubmatch(name); m != nil {
+		first = m[1] + ".001"
+	} else {
+		return path
+	}
+
+	firstPath := filepath.Join(dir, first)
+	if _, err := os.Stat(firstPath); err != nil {
+		return path
+	}
+	return firstPath
+}
+
+// isSubsequentVolume reports whether the given filename is a volume of a multi-volume archive set
+// other than the first one
+func isSubsequentVolume(name string) bool {
+	if m := rarPartVolumeRegexp.FindStringSubmatch(name); m != nil {
+		n, _ := strconv.Atoi(m[2])
+		return n != 1
+	}
+	if m := sevenZipVolumeRegexp.FindStringSubmatch(name); m != nil {
+		return m[2] != "001"
+	}
+	return false
+}
+
+func isSevenZipVolume(name string) bool {
+	return sevenZipVolumeRegexp.MatchString(filepath.Base(name))
+}
@@ -20,55 +20,182 @@ package archive
 
 import (
 	"archive/zip"
+	"context"
 	"errors"
+	"io"
+	"log"
+	"os"
 	"path/filepath"
 	"sort"
+	"sync"
 
-	"github.com/fauu/gomicsv/pixbuf"
-	"github.com/gotk3/gotk3/gdk"
+	yzip "github.com/yeka/zip"
 )
 
 type Zip struct {
-	files  []*zip.File // File elements sorted by their Names
-	reader *zip.ReadCloser
-	name   string // Name of the Zip file
+	mu       sync.RWMutex // Guards files, closer and comicInfo, which are replaced when metadata is written
+	files    []zipMember  // Sorted by their names
+	closer   io.Closer    // Closes the underlying file
+	name     string       // Name of the Zip file
+	path     string       // Empty if the Zip is nested in another archive
+	password string
+
+	comicInfo *ComicInfo
+}
+
+// zipMember is a file inside a zip archive. The archives are read with the standard library, save
+// for the encrypted ones, which it doesn't support
+type zipMember struct {
+	Name string
+	open func() (io.ReadCloser, error)
 }
 
-type zipfile []*zip.File
+type zipfile []zipMember
 
 func (p zipfile) Len() int           { return len(p) }
 func (p zipfile) Less(i, j int) bool { return strcmp(p[i].Name, p[j].Name, true) }
 func (p zipfile) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
-// NewZip reads filenames from a given zip archive and sorts them
-func NewZip(name string) (*Zip, error) {
-	var err error
-
-	ar := new(Zip)
+// The general purpose flag of an encrypted file
+const zipEncryptedFlag = 0x1
 
-	ar.name = filepath.Base(name)
-	ar.files = make([]*zip.File, 0, MaxArchiveEntries)
-	ar.reader, err = zip.OpenReader(name)
+// NewZip reads filenames from a given zip archive and sorts them. password is only used if the
+// images are encrypted
+func NewZip(name string, password string) (*Zip, error) {
+	f, err := os.Open(name)
 	if err != nil {
 		return nil, err
 	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
 
-	for _, f := range ar.reader.File {
-		if !extensionMatches(f.Name, imageExtensions) {
-			continue
-		}
-		ar.files = append(ar.files, f)
+	ar, err := newZip(filepath.Base(name), f, fi.Size(), f, password)
+	if err != nil {
+		return nil, err
 	}
+	ar.path = name
+	ar.password = password
+	return ar, nil
+}
 
-	if len(ar.files) == 0 {
+// newZip makes a Zip out of the zip archive that r reads. closer is closed along with the Zip or
+// when an error is returned
+func newZip(name string, r io.ReaderAt, size int64, closer io.Closer, password string) (*Zip, error) {
+	ar := &Zip{name: name, closer: closer}
+
+	files, comicInfoFile, err := listZip(r, size, password)
+	if err != nil {
+		ar.closer.Close()
+		return nil, err
+	}
+	if len(files) == 0 {
+		ar.closer.Close()
 		return nil, errors.New(ar.name + ": no images in the zip file")
 	}
+	ar.files = files
 
 	sort.Sort(zipfile(ar.files))
 
+	if comicInfoFile != nil {
+		if ar.comicInfo, err = readZipComicInfo(*comicInfoFile); err != nil {
+			log.Printf("Error reading %s from %s: %v", ComicInfoFilename, ar.name, err)
+		}
+	}
+
 	return ar, nil
 }
 
+// listZip returns the images and the ComicInfo.xml, if any, in a zip archive. If any of them are
+// encrypted, the archive is read again with a zip implementation supporting encryption, and the
+// password is verified
+func listZip(r io.ReaderAt, size int64, password string) (files []zipMember, comicInfoFile *zipMember, err error) {
+	add := func(m zipMember) {
+		if isComicInfo(m.Name) {
+			comicInfoFile = &m
+		} else if extensionMatches(m.Name, imageExtensions) {
+			files = append(files, m)
+		}
+	}
+
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	encrypted := false
+	for _, f := range reader.File {
+		add(zipMember{Name: f.Name, open: f.Open})
+		if f.Flags&zipEncryptedFlag != 0 && (isComicInfo(f.Name) || extensionMatches(f.Name, imageExtensions)) {
+			encrypted = true
+		}
+	}
+	if !encrypted || len(files) == 0 {
+		return files, comicInfoFile, nil
+	}
+
+	if password == "" {
+		return nil, nil, ErrPasswordRequired
+	}
+	encryptedReader, err := yzip.NewReader(r, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, comicInfoFile = nil, nil
+	var firstEncrypted *yzip.File
+	for _, f := range encryptedReader.File {
+		if f.IsEncrypted() {
+			f.SetPassword(password)
+			if firstEncrypted == nil && extensionMatches(f.Name, imageExtensions) {
+				firstEncrypted = f
+			}
+		}
+		add(zipMember{Name: f.Name, open: f.Open})
+	}
+	if firstEncrypted != nil {
+		if err := verifyZipPassword(firstEncrypted); err != nil {
+			return nil, nil, err
+		}
+	}
+	return files, comicInfoFile, nil
+}
+
+func readZipComicInfo(m zipMember) (*ComicInfo, error) {
+	rc, err := m.open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ParseComicInfo(rc)
+}
+
+// verifyZipPassword checks whether the password set for an encrypted file is correct by reading
+// the file in full, since not all encryption methods allow to verify the password upfront
+func verifyZipPassword(f *yzip.File) error {
+	rc, err := f.Open()
+	if err != nil {
+		return zipPasswordError(err)
+	}
+	defer rc.Close()
+	if _, err := io.Copy(io.Discard, rc); err != nil {
+		return zipPasswordError(err)
+	}
+	return nil
+}
+
+// zipPasswordError turns the errors meaning a wrong password into ErrBadPassword. Checksum errors
+// aren't among them, since they may just as well mean that the archive is corrupt
+func zipPasswordError(err error) error {
+	if errors.Is(err, yzip.ErrPassword) ||
+		errors.Is(err, yzip.ErrAuthentication) ||
+		errors.Is(err, yzip.ErrDecryption) {
+
+		return ErrBadPassword
+	}
+	return err
+}
+
 func (ar *Zip) checkbounds(i int) error {
 	if i < 0 || i >= len(ar.files) {
 		return ErrBounds
@@ -76,18 +203,22 @@ func (ar *Zip) checkbounds(i int) error {
 	return nil
 }
 
-func (ar *Zip) Load(i int, autorotate bool, _nPreload int) (*gdk.Pixbuf, error) {
+func (ar *Zip) Load(ctx context.Context, i int, _nPreload int) (*Page, error) {
+	// Held while reading, so that the file isn't closed under us
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+
 	if err := ar.checkbounds(i); err != nil {
 		return nil, err
 	}
 
-	f, err := ar.files[i].Open()
+	f, err := ar.files[i].open()
 	if err != nil {
 		return nil, err
 	}
 
 	defer f.Close()
-	return pixbuf.Load(f, autorotate)
+	return readPage(ctx, ar.files[i].Name, f)
 }
 
 func (ar *Zip) Kind() Kind {
@@ -99,6 +230,9 @@ func (ar *Zip) ArchiveName() string {
 }
 
 func (ar *Zip) Name(i int) (string, error) {
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+
 	if err := ar.checkbounds(i); err != nil {
 		return "", err
 	}
@@ -107,10 +241,23 @@ func (ar *Zip) Name(i int) (string, error) {
 }
 
 func (ar *Zip) Len() *int {
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+
 	l := len(ar.files)
 	return &l
 }
 
+func (ar *Zip) Metadata() *ComicInfo {
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+
+	return ar.comicInfo
+}
+
 func (ar *Zip) Close() error {
-	return ar.reader.Close()
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+
+	return ar.closer.Close()
 }
@@ -0,0 +1,249 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gomicsv
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+
+	"github.com/fauu/gomicsv/archive"
+	"github.com/fauu/gomicsv/pixbuf"
+)
+
+func (app *App) archiveInfoDialogInit() {
+	closeButton, err := app.W.ArchiveInfoDialog.AddButton("_Close", gtk.RESPONSE_CLOSE)
+	checkDialogAddButtonErr(err)
+
+	app.W.ArchiveInfoDialog.SetDefault(closeButton)
+}
+
+func (app *App) archiveInfoDialogRun() {
+	if !app.archiveIsLoaded() || app.S.Archive == nil {
+		return
+	}
+
+	metadata := app.archiveMetadata()
+
+	app.W.ArchiveInfoListStore.Clear()
+	addField := func(field string, value string) {
+		if value == "" {
+			return
+		}
+		iter := app.W.ArchiveInfoListStore.Append()
+		err := app.W.ArchiveInfoListStore.Set(iter, []int{0, 1}, []interface{}{field, value})
+		if err != nil {
+			log.Printf("Error setting archive info: %v", err)
+		}
+	}
+
+	addField("Path", app.S.ArchivePath)
+	if size, ok := app.archiveFileSize(); ok {
+		addField("File size", formatFileSize(size))
+	}
+	if app.S.Archive.Len() != nil {
+		addField("Pages", fmt.Sprint(*app.S.Archive.Len()))
+	} else {
+		addField("Pages", "Unknown")
+	}
+	if app.S.PageCache != nil {
+		stats := app.S.PageCache.Stats()
+		addField("Page cache", fmt.Sprintf("%d pages (%s), %d hits, %d misses, %d evictions",
+			stats.Pages, formatFileSize(stats.Size), stats.Hits, stats.Misses, stats.Evictions))
+	}
+	if metadata != nil {
+		addField("Title", metadata.Title)
+		addField("Series", metadata.Series)
+		addField("Number", metadata.Number)
+		addField("Volume", metadata.Volume)
+		addField("Count", metadata.Count)
+		addField("Date", strings.Join(nonEmpty(metadata.Year, metadata.Month, metadata.Day), "-"))
+		addField("Writer", metadata.Writer)
+		addField("Penciller", metadata.Penciller)
+		addField("Inker", metadata.Inker)
+		addField("Colorist", metadata.Colorist)
+		addField("Letterer", metadata.Letterer)
+		addField("Cover artist", metadata.CoverArtist)
+		addField("Editor", metadata.Editor)
+		addField("Publisher", metadata.Publisher)
+		addField("Genre", metadata.Genre)
+		addField("Language", metadata.LanguageISO)
+		addField("Manga", metadata.Manga)
+		addField("Web", metadata.Web)
+		addField("Summary", metadata.Summary)
+	}
+
+	stopFillingPages := app.archiveInfoFillPages(metadata)
+
+	app.W.ArchiveInfoDialog.Run()
+	app.W.ArchiveInfoDialog.Hide()
+
+	stopFillingPages()
+	app.W.ArchiveInfoListStore.Clear()
+	app.W.ArchiveInfoPagesListStore.Clear()
+}
+
+// archiveInfoFillPages lists the pages of the current archive in the Archive info dialog. Page
+// dimensions not present in the metadata are determined by loading the pages one by one in a
+// goroutine, which continues until the returned function is called
+func (app *App) archiveInfoFillPages(metadata *archive.ComicInfo) (stop func()) {
+	store := app.W.ArchiveInfoPagesListStore
+	store.Clear()
+
+	if app.S.Archive.Len() == nil {
+		return func() {}
+	}
+
+	n := *app.S.Archive.Len()
+	iters := make([]*gtk.TreeIter, n)
+	known := make([]bool, n) // Whether the dimensions are known
+	for i := 0; i < n; i++ {
+		name, _ := app.S.Archive.Name(i)
+		pageType, dimensions := "", ""
+		if metadata != nil {
+			if page := metadata.Page(i); page != nil {
+				pageType = page.Type
+				if page.ImageWidth > 0 && page.ImageHeight > 0 {
+					dimensions = fmt.Sprintf("%dx%d", page.ImageWidth, page.ImageHeight)
+					known[i] = true
+				}
+			}
+		}
+		iters[i] = store.Append()
+		err := store.Set(iters[i], []int{0, 1, 2, 3}, []interface{}{i + 1, name, pageType, dimensions})
+		if err != nil {
+			log.Printf("Error setting archive info page: %v", err)
+		}
+	}
+
+	if app.S.Archive.Kind() == archive.HTTPKind {
+		// Don't download the whole archive just for that
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ar := app.S.Archive
+	go func() {
+		for i := 0; i < n; i++ {
+			if ctx.Err() != nil {
+				return
+			}
+			if known[i] {
+				continue
+			}
+			text := "?"
+			if w, h, ok := pageSize(ctx, ar, i); ok {
+				text = fmt.Sprintf("%dx%d", w, h)
+			}
+			iter := iters[i]
+			glib.IdleAdd(func() bool {
+				// The dialog has been closed and the rows cleared
+				if ctx.Err() != nil {
+					return false
+				}
+				if err := store.SetValue(iter, 3, text); err != nil {
+					log.Printf("Error setting archive info page dimensions: %v", err)
+				}
+				return false
+			})
+		}
+	}()
+	return cancel
+}
+
+// pageSize returns the dimensions of page i of ar, decoding as little of it as possible
+func pageSize(ctx context.Context, ar archive.Archive, i int) (w, h int, ok bool) {
+	page, err := ar.Load(ctx, i, 0)
+	if err != nil {
+		return 0, 0, false
+	}
+	if config, err := page.DecodeConfig(); err == nil {
+		return config.Width, config.Height, true
+	}
+	decoded, err := pixbuf.Decode(page.Data, false)
+	if err != nil {
+		return 0, 0, false
+	}
+	return decoded.GetWidth(), decoded.GetHeight(), true
+}
+
+// archiveMetadata returns the ComicInfo metadata of the current archive, if it has any
+func (app *App) archiveMetadata() *archive.ComicInfo {
+	if provider, ok := app.S.Archive.(archive.MetadataProvider); ok {
+		return provider.Metadata()
+	}
+	return nil
+}
+
+// archiveFileSize returns the size of the file containing the current archive
+func (app *App) archiveFileSize() (int64, bool) {
+	if app.S.Archive.Kind() == archive.HTTPKind {
+		return 0, false
+	}
+	path := app.S.ArchivePath
+	if container, _, ok := archive.SplitNestedPath(path); ok {
+		path = container
+	}
+	fi, err := os.Stat(path)
+	if err != nil || !fi.Mode().IsRegular() {
+		return 0, false
+	}
+	return fi.Size(), true
+}
+
+// applyArchiveMetadata adjusts the settings to the metadata of the current archive for as long as
+// it stays open
+func (app *App) applyArchiveMetadata() {
+	metadata := app.archiveMetadata()
+	if metadata == nil {
+		return
+	}
+	if metadata.RightToLeft() && !app.mangaMode() {
+		app.forceMangaMode(true)
+		app.notificationShow("Manga mode enabled as indicated by the archive’s metadata", ShortNotification)
+	}
+}
+
+func formatFileSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func nonEmpty(strs ...string) []string {
+	res := make([]string, 0, len(strs))
+	for _, s := range strs {
+		if s != "" {
+			res = append(res, s)
+		}
+	}
+	return res
+}
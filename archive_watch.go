@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gomicsv
+
+import (
+	"log"
+
+	"github.com/gotk3/gotk3/glib"
+
+	"github.com/fauu/gomicsv/archive"
+	"github.com/fauu/gomicsv/imgdiff"
+)
+
+// watchArchive starts following the changes to the current archive if it can change while open
+func (app *App) watchArchive() {
+	watchable, ok := app.S.Archive.(archive.Watchable)
+	if !ok {
+		return
+	}
+
+	ar := app.S.Archive
+	err := watchable.Watch(func() {
+		glib.IdleAdd(func() bool {
+			if app.S.Archive == ar {
+				app.syncArchive()
+			}
+			return false
+		})
+	})
+	if err != nil {
+		log.Printf("Could not watch %s for changes: %v", ar.ArchiveName(), err)
+	}
+}
+
+// watchArchiveLen updates the UI once the length of the current archive becomes known, if it
+// isn't yet
+func (app *App) watchArchiveLen() {
+	discoverer, ok := app.S.Archive.(archive.LenDiscoverer)
+	if !ok || app.S.Archive.Len() != nil {
+		return
+	}
+
+	ar := app.S.Archive
+	discoverer.OnLenKnown(func() {
+		glib.IdleAdd(func() bool {
+			if app.S.Archive == ar {
+				app.archiveHandleLenKnowledge(true)
+				app.updateStatus()
+			}
+			return false
+		})
+	})
+}
+
+// watchArchiveMetadata applies the metadata of the current archive once it is found, if it isn't
+// yet
+func (app *App) watchArchiveMetadata() {
+	discoverer, ok := app.S.Archive.(archive.MetadataDiscoverer)
+	if !ok || app.archiveMetadata() != nil {
+		return
+	}
+
+	ar := app.S.Archive
+	discoverer.OnMetadataKnown(func() {
+		glib.IdleAdd(func() bool {
+			if app.S.Archive == ar {
+				app.applyArchiveMetadata()
+			}
+			return false
+		})
+	})
+}
+
+// syncArchive applies the pending changes to a watched archive without changing the displayed
+// page, unless it has been modified. Returns whether there were any
+func (app *App) syncArchive() bool {
+	watchable, ok := app.S.Archive.(archive.Watchable)
+	if !ok {
+		return false
+	}
+
+	currentName, _ := app.S.Archive.Name(app.S.ArchivePos)
+	markedNames := app.jumpmarkedPageNames()
+	changes := watchable.Sync()
+	if len(changes) == 0 {
+		return false
+	}
+
+	modified := false
+	if i := app.archivePageIndex(currentName); i != -1 {
+		_, kept := archive.MapIndex(app.S.ArchivePos, changes)
+		modified = !kept
+		app.S.ArchivePos = i
+	} else if l := app.S.Archive.Len(); l != nil && *l > 0 && app.S.ArchivePos >= *l {
+		// The current page has been removed
+		app.S.ArchivePos = *l - 1
+	}
+	app.relocateJumpmarks(markedNames)
+
+	// The page being loaded might have moved
+	reload := app.pageLoadCancel() || modified
+
+	// What is indexed by page follows the pages that are still there
+	app.prefetchCancel()
+	reindex := func(i int) (int, bool) { return archive.MapIndex(i, changes) }
+	app.S.PageCache.Reindex(reindex)
+	for _, mark := range app.S.Jumpmarks.list {
+		// Modified pages have lost their pins
+		app.S.PageCache.Pin(mark - 1)
+	}
+	hashes := make(map[int]imgdiff.Hash, len(app.S.ImageHashes))
+	for i, hash := range app.S.ImageHashes {
+		if j, ok := reindex(i); ok {
+			hashes[j] = hash
+		}
+	}
+	app.S.ImageHashes = hashes
+	if pos, ok := reindex(app.S.PrefetchPos); ok {
+		app.S.PrefetchPos = pos
+	}
+	app.rebuildChaptersMenu()
+	app.chaptersHandleSetPage(app.S.ArchivePos)
+	app.updateStatus()
+	if reload {
+		app.doSetPage(app.S.ArchivePos)
+	} else {
+		app.prefetchAround(app.S.ArchivePos)
+	}
+
+	return true
+}
+
+// archivePageIndex returns the index of the page with the given name, or -1 if there isn't one
+func (app *App) archivePageIndex(name string) int {
+	if name == "" || app.S.Archive.Len() == nil {
+		return -1
+	}
+	for i := 0; i < *app.S.Archive.Len(); i++ {
+		if n, _ := app.S.Archive.Name(i); n == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gomicsv
+
+import (
+	"fmt"
+
+	"github.com/gotk3/gotk3/gtk"
+
+	"github.com/fauu/gomicsv/archive"
+	"github.com/fauu/gomicsv/util"
+)
+
+var chapterMenuItems []*gtk.MenuItem
+
+// archiveChapters returns the chapters of the current archive, if known
+func (app *App) archiveChapters() []archive.Chapter {
+	if !app.archiveIsLoaded() || app.S.Archive == nil {
+		return nil
+	}
+	if chaptered, ok := app.S.Archive.(archive.Chaptered); ok {
+		return chaptered.Chapters()
+	}
+	return nil
+}
+
+func (app *App) nextChapter() {
+	chapters := app.archiveChapters()
+	next := archive.ChapterIndexAt(chapters, app.S.ArchivePos) + 1
+	if next >= len(chapters) {
+		return
+	}
+	app.setPage(chapters[next].Start)
+}
+
+func (app *App) previousChapter() {
+	chapters := app.archiveChapters()
+	prev := archive.ChapterIndexAt(chapters, app.S.ArchivePos) - 1
+	if prev < 0 {
+		return
+	}
+	app.setPage(chapters[prev].Start)
+}
+
+func (app *App) chaptersHandleSetPage(page int) {
+	chapters := app.archiveChapters()
+	current := archive.ChapterIndexAt(chapters, page)
+	app.W.MenuItemPreviousChapter.SetSensitive(current > 0)
+	app.W.MenuItemNextChapter.SetSensitive(current+1 < len(chapters))
+}
+
+func (app *App) rebuildChaptersMenu() {
+	for _, item := range chapterMenuItems {
+		app.W.MenuChapters.Remove(item)
+		item.Destroy()
+	}
+	chapterMenuItems = nil
+	util.GC()
+
+	chapters := app.archiveChapters()
+	app.W.MenuItemChapters.SetSensitive(len(chapters) > 0)
+	app.W.MenuItemPreviousChapter.SetSensitive(false)
+	app.W.MenuItemNextChapter.SetSensitive(false)
+
+	for _, chapter := range chapters {
+		label := fmt.Sprintf("%s (%d)", chapter.Title, chapter.Start+1)
+		menuItem, err := gtk.MenuItemNewWithLabel(label)
+		if err != nil {
+			app.showError(err.Error())
+			return
+		}
+		page := chapter.Start // Make a new variable so that the correct value gets passed to the callback
+		menuItem.Connect("activate", func() {
+			app.setPage(page)
+		})
+		chapterMenuItems = append(chapterMenuItems, menuItem)
+		app.W.MenuChapters.Append(menuItem)
+		menuItem.Show()
+	}
+}
@@ -30,9 +30,11 @@ var (
 	buildDate     = ""
 	versionString = ""
 
-	referer = flag.String("referer", "", "HTTP Referer value to use for requests when the provided path is a URL")
-	help    = flag.BoolP("help", "h", false, "Print usage message and exit")
-	version = flag.BoolP("version", "v", false, "Print program version and exit")
+	referer   = flag.String("referer", "", "HTTP Referer value to use for requests when the provided path is a URL")
+	recursive = flag.BoolP("recursive", "r", false, "Open directories together with all their subdirectories, as a single comic")
+	checkRule = flag.String("check-gallery-rule", "", "Print what the gallery rule for the chapter at the URL given as the path finds in the saved HTML page of the chapter at the specified location, and exit")
+	help      = flag.BoolP("help", "h", false, "Print usage message and exit")
+	version   = flag.BoolP("version", "v", false, "Print program version and exit")
 )
 
 func main() {
@@ -40,7 +42,7 @@ func main() {
 		fmt.Fprintf(
 			os.Stderr,
 			"Usage: %s [path] [options]:\n"+
-				"      path               Path to the comic to load at startup. Could be filesystem path, a URL of one of the images or a URL template for all of the images\n"+
+				"      path               Path to the comic to load at startup. Could be filesystem path, a URL of one of the images, a URL template for all of the images or a URL of a chapter page matched by a gallery rule\n"+
 				"   Options:\n",
 			gomicsv.AppName,
 		)
@@ -58,10 +60,23 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *checkRule != "" {
+		if flag.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "The URL of the chapter must be given as the path")
+			os.Exit(2)
+		}
+		if err := gomicsv.CheckGalleryRule(*checkRule, flag.Arg(0), os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	nonFlagArgs := []string{os.Args[0]}
 	nonFlagArgs = append(nonFlagArgs, flag.Args()...)
 	initParams := gomicsv.AppStartupParams{
-		Referer: *referer,
+		Referer:      *referer,
+		RecursiveDir: *recursive,
 	}
 
 	app := gomicsv.App{}
@@ -28,11 +28,15 @@ import (
 
 	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/gtk"
+
+	"github.com/fauu/gomicsv/archive"
 )
 
 const (
 	ConfigFilename = "config"
 	ReadLaterDir   = "read-later"
+	PasswordsDir   = "passwords"
+	HTTPCacheDir   = "http-cache"
 )
 
 type Config struct {
@@ -53,6 +57,10 @@ type Config struct {
 	BackgroundColor            Color
 	NSkip                      int
 	NPreload                   int
+	PageCacheSize              int // In MB
+	HTTPCacheSize              int // In MB
+	HTTPProbeLength            bool
+	HTTPProfiles               []archive.HTTPProfile
 	RememberRecent             bool
 	RememberPosition           bool
 	RememberPositionHTTP       bool
@@ -63,6 +71,7 @@ type Config struct {
 	SceneScanSkip              int
 	SmartScroll                bool
 	MangaModeReverseNavigation bool
+	RecursiveDir               bool
 	HideIdleCursor             bool
 	KamiteEnabled              bool
 	KamitePort                 int
@@ -103,6 +112,9 @@ func (c *Config) setDefaults() {
 	c.WindowHeight = 480
 	c.NSkip = 10
 	c.NPreload = 2
+	c.PageCacheSize = 512
+	c.HTTPCacheSize = 1024
+	c.HTTPProbeLength = true
 	c.Seamless = true
 	c.RememberRecent = true
 	c.RememberPosition = false
@@ -238,6 +250,23 @@ func (app *App) setDoublePage(doublePage bool) {
 
 func (app *App) setMangaMode(mangaMode bool) {
 	app.Config.MangaMode = mangaMode
+	app.applyMangaMode()
+}
+
+// forceMangaMode enables the manga mode for the current archive only, leaving the setting intact
+func (app *App) forceMangaMode(forced bool) {
+	app.S.MangaModeForced = forced
+	app.W.MenuItemMangaMode.SetActive(app.mangaMode())
+	app.applyMangaMode()
+}
+
+// mangaMode returns whether the manga mode is in effect, either set or forced for the current
+// archive
+func (app *App) mangaMode() bool {
+	return app.Config.MangaMode || app.S.MangaModeForced
+}
+
+func (app *App) applyMangaMode() {
 	app.syncMirrorNavigationButtonsTextDirection()
 	app.blit()
 	app.updateStatus()
@@ -301,6 +330,28 @@ func (app *App) setMangaModeReverseNavigation(mangaModeReverseNavigation bool) {
 	app.syncMirrorNavigationButtonsTextDirection()
 }
 
+func (app *App) setPageCacheSize(pageCacheSize int) {
+	app.Config.PageCacheSize = pageCacheSize
+	if app.S.PageCache != nil {
+		app.S.PageCache.SetBudget(pageCacheSize)
+	}
+}
+
+func (app *App) setHTTPCacheSize(httpCacheSize int) {
+	app.Config.HTTPCacheSize = httpCacheSize
+	if app.S.HTTPCache != nil {
+		app.S.HTTPCache.SetBudget(httpCacheSize)
+	}
+}
+
+func (app *App) setHTTPProbeLength(httpProbeLength bool) {
+	app.Config.HTTPProbeLength = httpProbeLength
+}
+
+func (app *App) setRecursiveDir(recursiveDir bool) {
+	app.Config.RecursiveDir = recursiveDir
+}
+
 func (app *App) setHideIdleCursor(hideIdleCursor bool) {
 	app.Config.HideIdleCursor = hideIdleCursor
 }
@@ -7,9 +7,29 @@ go 1.24
 toolchain go1.24.0
 
 require (
+	github.com/andybalholm/cascadia v1.3.3
+	github.com/bodgit/sevenzip v1.6.0
 	github.com/flytam/filenamify v1.2.0
 	github.com/gotk3/gotk3 v0.6.5-0.20240618185848-ff349ae13f56 // https://github.com/gotk3/gotk3/issues/932
 	github.com/nwaples/rardecode/v2 v2.1.0
 	github.com/spf13/pflag v1.0.5
+	github.com/ulikunitz/xz v0.5.12
+	github.com/yeka/zip v0.0.0-20231116150916-03d6312748a9
+	golang.org/x/image v0.25.0
+	golang.org/x/net v0.33.0
 	golang.org/x/sys v0.30.0
 )
+
+require (
+	github.com/andybalholm/brotli v1.1.1 // indirect
+	github.com/bodgit/plumbing v1.3.0 // indirect
+	github.com/bodgit/windows v1.0.1 // indirect
+	github.com/hashicorp/errwrap v1.0.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
+	go4.org v0.0.0-20200411211856-f5505b9728dd // indirect
+	golang.org/x/crypto v0.31.0 // indirect
+	golang.org/x/text v0.23.0 // indirect
+)
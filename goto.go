@@ -45,7 +45,7 @@ func (app *App) goToDialogInit() {
 
 func (app *App) goToDialogUpdateThumbnail() {
 	n := int(app.W.GoToSpinButton.GetValue() - 1)
-	pixbuf, err := app.S.Archive.Load(n, app.Config.EmbeddedOrientation, 0)
+	pixbuf, err := app.loadPage(n, 0)
 	if err != nil {
 		log.Printf("Error getting thumbnail: %v", err)
 		return
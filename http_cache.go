@@ -0,0 +1,50 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gomicsv
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/fauu/gomicsv/httpcache"
+)
+
+// httpCacheInit opens the on-disk cache of the pages of HTTP archives. They are downloaded every
+// time if that fails
+func (app *App) httpCacheInit() {
+	cache, err := httpcache.NewHTTPCache(filepath.Join(app.S.UserDataDirPath, HTTPCacheDir), app.Config.HTTPCacheSize)
+	if err != nil {
+		log.Printf("Error opening the HTTP cache: %v", err)
+		return
+	}
+	app.S.HTTPCache = cache
+}
+
+func (app *App) clearHTTPCache() {
+	if app.S.HTTPCache == nil {
+		return
+	}
+	size := app.S.HTTPCache.Size()
+	if err := app.S.HTTPCache.Clear(); err != nil {
+		app.showError(fmt.Sprintf("Couldn't clear the HTTP cache: %v", err))
+		return
+	}
+	app.notificationShow(fmt.Sprintf("Cleared the HTTP cache (%.1f MB)", float64(size)/(1024*1024)), ShortNotification)
+}
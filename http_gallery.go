@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gomicsv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/fauu/gomicsv/archive"
+)
+
+// CheckGalleryRule writes out what the gallery rule of the HTTP profile in the config matching
+// pageURL finds in a saved HTML page of a chapter, so that the rules can be worked on offline
+func CheckGalleryRule(htmlPath string, pageURL string, w io.Writer) error {
+	configPath, err := getConfigLocation(AppName)
+	if err != nil {
+		return err
+	}
+	var config Config
+	config.setDefaults()
+	if err := config.load(filepath.Join(configPath, ConfigFilename)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("loading config: %v", err)
+	}
+
+	profile, err := archive.MatchHTTPProfile(config.HTTPProfiles, pageURL)
+	if err != nil {
+		return err
+	}
+	if profile == nil || profile.Gallery == nil {
+		return fmt.Errorf("No HTTP profile with a gallery rule matches %s", pageURL)
+	}
+	page, err := os.ReadFile(htmlPath)
+	if err != nil {
+		return err
+	}
+	gallery, err := archive.ScrapeGallery(page, pageURL, *profile.Gallery)
+	if err != nil {
+		return fmt.Errorf("HTTP profile %q: %v", profile.Name, err)
+	}
+
+	fmt.Fprintf(w, "HTTP profile: %s\n", profile.Name)
+	fmt.Fprintf(w, "Images (%d):\n", len(gallery.ImageURLs))
+	for _, u := range gallery.ImageURLs {
+		fmt.Fprintf(w, "  %s\n", u)
+	}
+	fmt.Fprintf(w, "Next chapter: %s\n", orNone(gallery.NextURL))
+	fmt.Fprintf(w, "Previous chapter: %s\n", orNone(gallery.PreviousURL))
+	if len(gallery.ImageURLs) == 0 {
+		return errors.New("No images found")
+	}
+	return nil
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
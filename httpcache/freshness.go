@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpcache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How long a response stays fresh if it doesn't say and the time of its last modification is
+// unknown
+const defaultFreshness = 24 * time.Hour
+
+// NewEntry makes the entry for a response to a request for url, unless the response forbids
+// storing it
+func NewEntry(url string, contentType string, data []byte, header http.Header, now time.Time) (*Entry, bool) {
+	expires, storable := expiry(header, now)
+	if !storable {
+		return nil, false
+	}
+	return &Entry{
+		Data:         data,
+		URL:          url,
+		ContentType:  contentType,
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		Expires:      expires,
+	}, true
+}
+
+// Fresh reports whether the entry can be used without revalidating it
+func (e *Entry) Fresh(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+// ConditionalHeaders returns the headers that make a request for the entry's URL answerable with
+// 304 Not Modified if the entry is still valid
+func (e *Entry) ConditionalHeaders() map[string]string {
+	headers := make(map[string]string)
+	if e.ETag != "" {
+		headers["If-None-Match"] = e.ETag
+	}
+	if e.LastModified != "" {
+		headers["If-Modified-Since"] = e.LastModified
+	}
+	return headers
+}
+
+// Update applies the headers of a 304 Not Modified response to the entry. Returns false if the
+// entry must no longer be stored
+func (e *Entry) Update(header http.Header, now time.Time) bool {
+	expires, storable := expiry(header, now)
+	if !storable {
+		return false
+	}
+	e.Expires = expires
+	if etag := header.Get("ETag"); etag != "" {
+		e.ETag = etag
+	}
+	if lastModified := header.Get("Last-Modified"); lastModified != "" {
+		e.LastModified = lastModified
+	}
+	return true
+}
+
+// expiry determines until when a response received at now stays fresh, going by Cache-Control,
+// then Expires, and finally estimating it as 10% of the time since its last modification, like
+// browsers do
+func expiry(header http.Header, now time.Time) (expires time.Time, storable bool) {
+	directives := cacheControl(header)
+	if _, ok := directives["no-store"]; ok {
+		return time.Time{}, false
+	}
+	if _, ok := directives["no-cache"]; ok {
+		return now, true
+	}
+
+	var age time.Duration
+	if secs, err := strconv.Atoi(header.Get("Age")); err == nil && secs > 0 {
+		age = time.Duration(secs) * time.Second
+	}
+	if maxAge, ok := directives["max-age"]; ok {
+		secs, err := strconv.Atoi(maxAge)
+		if err != nil {
+			return now, true
+		}
+		return now.Add(time.Duration(secs)*time.Second - age), true
+	}
+
+	if v := header.Get("Expires"); v != "" {
+		// An invalid date means that the response has already expired
+		t, err := http.ParseTime(v)
+		if err != nil {
+			return now, true
+		}
+		return t, true
+	}
+
+	if lastModified, err := http.ParseTime(header.Get("Last-Modified")); err == nil && lastModified.Before(now) {
+		return now.Add(now.Sub(lastModified) / 10), true
+	}
+	return now.Add(defaultFreshness), true
+}
+
+// cacheControl parses the Cache-Control header into a map of directives to their arguments
+func cacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
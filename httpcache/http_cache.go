@@ -0,0 +1,328 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpcache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const bytesPerMB = 1024 * 1024
+
+const (
+	metadataExt    = ".json"
+	tempFilePrefix = ".tmp-"
+)
+
+// HTTPCache keeps HTTP responses on disk, evicting the least recently used ones once their total
+// size exceeds the budget. Each response is stored as a file named after the hash of its URL,
+// with the metadata in a JSON file next to it. The modification times of the former keep the
+// order of use between runs. Safe for concurrent use
+type HTTPCache struct {
+	dir     string
+	mutex   sync.Mutex
+	budget  int64 // In bytes
+	size    int64
+	entries map[string]*list.Element
+	lru     *list.List // Of *indexEntry, the most recently used first
+
+	// Responses are written without holding the mutex. Ones that get removed in the meantime
+	// are marked, so that their files are removed again once written
+	writing map[string]int  // Number of responses being written, by key
+	removed map[string]bool // Keys removed while being written
+}
+
+type indexEntry struct {
+	key  string
+	size int64
+}
+
+// Entry is a cached response
+type Entry struct {
+	Data         []byte `json:"-"`
+	URL          string
+	ContentType  string
+	ETag         string    `json:",omitempty"`
+	LastModified string    `json:",omitempty"`
+	Expires      time.Time // The response must be revalidated after this time
+}
+
+// NewHTTPCache opens the cache stored in dir, creating the directory if needed
+func NewHTTPCache(dir string, budgetMB int) (*HTTPCache, error) {
+	// Private, since the responses may contain what the user has browsed
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	c := &HTTPCache{
+		dir:     dir,
+		budget:  int64(budgetMB) * bytesPerMB,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		writing: make(map[string]int),
+		removed: make(map[string]bool),
+	}
+	if err := c.index(); err != nil {
+		return nil, err
+	}
+	c.evict("")
+	return c, nil
+}
+
+// index lists the responses already stored in the directory
+func (c *HTTPCache) index() error {
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	type stored struct {
+		indexEntry
+		used time.Time
+	}
+	var all []stored
+	for _, de := range dirEntries {
+		if strings.HasPrefix(de.Name(), tempFilePrefix) {
+			// Left over from an interrupted write
+			os.Remove(filepath.Join(c.dir, de.Name()))
+			continue
+		}
+		key, ok := strings.CutSuffix(de.Name(), metadataExt)
+		if !ok {
+			continue
+		}
+		fi, err := os.Stat(c.dataPath(key))
+		if err != nil {
+			// Left over from an interrupted write or removal
+			os.Remove(c.metadataPath(key))
+			continue
+		}
+		all = append(all, stored{indexEntry{key, fi.Size()}, fi.ModTime()})
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].used.After(all[j].used) })
+	for _, s := range all {
+		e := s.indexEntry
+		c.entries[e.key] = c.lru.PushBack(&e)
+		c.size += e.size
+	}
+	return nil
+}
+
+// Get returns the response for url, whether or not it is still fresh
+func (c *HTTPCache) Get(url string) (*Entry, bool) {
+	key := cacheKey(url)
+
+	c.mutex.Lock()
+	elem, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(elem)
+	}
+	c.mutex.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	metadata, err := os.ReadFile(c.metadataPath(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry Entry
+	if err := json.Unmarshal(metadata, &entry); err != nil || entry.URL != url {
+		return nil, false
+	}
+	if entry.Data, err = os.ReadFile(c.dataPath(key)); err != nil {
+		return nil, false
+	}
+
+	now := time.Now()
+	os.Chtimes(c.dataPath(key), now, now)
+	return &entry, true
+}
+
+// Put stores the response for url, replacing the previous one
+func (c *HTTPCache) Put(entry *Entry) error {
+	key := cacheKey(entry.URL)
+	size := int64(len(entry.Data))
+
+	metadata, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	tooLarge := size > c.budget
+	if !tooLarge {
+		c.writing[key]++
+	}
+	c.mutex.Unlock()
+	if tooLarge {
+		return nil
+	}
+
+	err = c.write(key, entry.Data, metadata)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	removed := c.removed[key]
+	if c.writing[key]--; c.writing[key] == 0 {
+		delete(c.writing, key)
+		delete(c.removed, key)
+	}
+	if err != nil {
+		return err
+	}
+	if removed {
+		// Cleared or evicted while being written
+		return c.remove(key)
+	}
+	if elem, ok := c.entries[key]; ok {
+		e := elem.Value.(*indexEntry)
+		c.size += size - e.size
+		e.size = size
+		c.lru.MoveToFront(elem)
+	} else {
+		c.entries[key] = c.lru.PushFront(&indexEntry{key, size})
+		c.size += size
+	}
+	c.evictLocked(key)
+	return nil
+}
+
+// write stores the files of a response. The metadata goes last, since its presence marks the
+// entry as complete
+func (c *HTTPCache) write(key string, data []byte, metadata []byte) error {
+	if err := writeFileAtomically(c.dataPath(key), data); err != nil {
+		return err
+	}
+	if err := writeFileAtomically(c.metadataPath(key), metadata); err != nil {
+		os.Remove(c.dataPath(key))
+		return err
+	}
+	return nil
+}
+
+// SetBudget changes the size limit, evicting responses if it has been lowered
+func (c *HTTPCache) SetBudget(budgetMB int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.budget = int64(budgetMB) * bytesPerMB
+	c.evictLocked("")
+}
+
+// Size returns the total size of the stored responses in bytes
+func (c *HTTPCache) Size() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.size
+}
+
+// Clear removes all the stored responses
+func (c *HTTPCache) Clear() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var errs []error
+	for key := range c.entries {
+		errs = append(errs, c.remove(key))
+	}
+	for key := range c.writing {
+		c.removed[key] = true
+	}
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+	return errors.Join(errs...)
+}
+
+func (c *HTTPCache) evict(keep string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.evictLocked(keep)
+}
+
+// evictLocked removes the least recently used responses, other than the one under the key keep,
+// until the total size fits in the budget
+func (c *HTTPCache) evictLocked(keep string) {
+	for elem := c.lru.Back(); elem != nil && c.size > c.budget; {
+		prev := elem.Prev()
+		e := elem.Value.(*indexEntry)
+		if e.key != keep {
+			c.remove(e.key)
+			c.lru.Remove(elem)
+			delete(c.entries, e.key)
+			c.size -= e.size
+		}
+		elem = prev
+	}
+}
+
+// remove deletes the files of the response under key. Must be called with the mutex held
+func (c *HTTPCache) remove(key string) error {
+	if c.writing[key] > 0 {
+		c.removed[key] = true
+	}
+	// The metadata goes first, for the same reason it is written last
+	if err := os.Remove(c.metadataPath(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(c.dataPath(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (c *HTTPCache) dataPath(key string) string {
+	return filepath.Join(c.dir, key)
+}
+
+func (c *HTTPCache) metadataPath(key string) string {
+	return filepath.Join(c.dir, key+metadataExt)
+}
+
+func cacheKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeFileAtomically(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), tempFilePrefix+"*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
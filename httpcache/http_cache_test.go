@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package httpcache
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func testEntry(url string, size int) *Entry {
+	return &Entry{Data: bytes.Repeat([]byte{1}, size), URL: url, ContentType: "image/png"}
+}
+
+func TestHTTPCache(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewHTTPCache(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const size = 400 * 1024
+	for _, url := range []string{"http://a", "http://b"} {
+		if err := c.Put(testEntry(url, size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := c.Get("http://a"); !ok {
+		t.Fatal("http://a not cached")
+	}
+	// The least recently used one goes first
+	if err := c.Put(testEntry("http://c", size)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("http://b"); ok {
+		t.Error("http://b not evicted")
+	}
+	if c.Size() != 2*size {
+		t.Errorf("Size() = %d, want %d", c.Size(), 2*size)
+	}
+
+	c, err = NewHTTPCache(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := c.Get("http://c")
+	if !ok || len(entry.Data) != size || entry.ContentType != "image/png" {
+		t.Fatalf("http://c not kept between runs: %v", ok)
+	}
+
+	if err := c.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("http://a"); ok || c.Size() != 0 {
+		t.Error("not cleared")
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		header   http.Header
+		expires  time.Time
+		storable bool
+	}{
+		{http.Header{"Cache-Control": {"no-store"}}, time.Time{}, false},
+		{http.Header{"Cache-Control": {"public, no-cache"}}, now, true},
+		{http.Header{"Cache-Control": {"max-age=60"}, "Age": {"10"}}, now.Add(50 * time.Second), true},
+		{http.Header{"Expires": {"Mon, 01 Jan 2024 01:00:00 GMT"}}, now.Add(time.Hour), true},
+		{http.Header{"Expires": {"0"}}, now, true},
+		{http.Header{"Last-Modified": {"Fri, 22 Dec 2023 00:00:00 GMT"}}, now.Add(24 * time.Hour), true},
+		{http.Header{}, now.Add(defaultFreshness), true},
+	} {
+		expires, storable := expiry(tt.header, now)
+		if !expires.Equal(tt.expires) || storable != tt.storable {
+			t.Errorf("expiry(%v) = %v, %v, want %v, %v", tt.header, expires, storable, tt.expires, tt.storable)
+		}
+	}
+}
@@ -22,10 +22,12 @@ import (
 	"fmt"
 	"log"
 	"path/filepath"
+	"strings"
 
 	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/gtk"
 
+	"github.com/fauu/gomicsv/archive"
 	"github.com/fauu/gomicsv/util"
 )
 
@@ -85,7 +87,7 @@ func (app *App) updateStatus() {
 		leftw, lefth := s.PixbufL.GetWidth(), s.PixbufL.GetHeight()
 		rightw, righth := s.PixbufR.GetWidth(), s.PixbufR.GetHeight()
 
-		if app.Config.MangaMode {
+		if app.mangaMode() {
 			left, right = right, left
 			leftIndex, rightIndex = rightIndex, leftIndex
 			leftw, rightw = rightw, leftw
@@ -94,6 +96,13 @@ func (app *App) updateStatus() {
 		title = fmt.Sprintf("[%d+%d / %s] %s", leftIndex, rightIndex, lenStr, s.Archive.ArchiveName())
 	} else {
 		imgPath, _ := s.Archive.Name(s.ArchivePos)
+		if chaptered, ok := s.Archive.(archive.Chaptered); ok {
+			chapter := archive.ChapterAt(chaptered.Chapters(), s.ArchivePos)
+			// Chapters made from directories are already evident from the path
+			if chapter != nil && chapter.Title != "" && !strings.HasPrefix(filepath.ToSlash(imgPath), chapter.Title+"/") {
+				imgPath = chapter.Title + " › " + imgPath
+			}
+		}
 		w, h := s.PixbufL.GetWidth(), s.PixbufL.GetHeight()
 		msg = fmt.Sprintf("%d / %s %s  |   %dx%d (%d%%)   |   %s   |   %s", s.ArchivePos+1, lenStr, markedStr, w, h, zoom, s.Archive.ArchiveName(), imgPath)
 		title = fmt.Sprintf("[%d / %s] %s", s.ArchivePos+1, lenStr, s.Archive.ArchiveName())
@@ -147,10 +156,21 @@ func (app *App) shouldForceSinglePage() bool {
 }
 
 func (app *App) blit() {
-	if !app.pixbufLoaded() {
+	if !app.blitPages() {
 		return
 	}
 
+	if app.S.Scale != 1 || app.Config.HFlip || app.Config.VFlip {
+		util.GC()
+	}
+}
+
+// blitPages displays the loaded pages. Returns false if there aren't any
+func (app *App) blitPages() bool {
+	if !app.pixbufLoaded() {
+		return false
+	}
+
 	app.S.Scale = app.getScaledSize()
 
 	// Check whether the scale of the left image is different from the old one?
@@ -159,30 +179,28 @@ func (app *App) blit() {
 		left := app.S.PixbufL
 		right := app.S.PixbufR
 
-		if app.Config.MangaMode {
+		if app.mangaMode() {
 			left, right = right, left
 		}
 
 		if err := app.doBlit(app.W.ImageL, left, app.S.Scale); err != nil {
 			app.showError(err.Error())
-			return
+			return false
 		}
 
 		if err := app.doBlit(app.W.ImageR, right, app.S.Scale); err != nil {
 			app.showError(err.Error())
-			return
+			return false
 		}
 	} else {
 		app.W.ImageR.Clear()
 		if err := app.doBlit(app.W.ImageL, app.S.PixbufL, app.S.Scale); err != nil {
 			app.showError(err.Error())
-			return
+			return false
 		}
 	}
 
-	if app.S.Scale != 1 || app.Config.HFlip || app.Config.VFlip {
-		util.GC()
-	}
+	return true
 }
 
 func (app *App) doBlit(image *gtk.Image, pixbuf *gdk.Pixbuf, scale float64) (err error) {
@@ -274,7 +292,7 @@ func (app *App) copyImageToClipboard() {
 // getStichedPixbuf creates a Pixbuf combining the left and right image Pixbufs
 func (app *App) getStichedPixbuf() (*gdk.Pixbuf, error) {
 	l, r := app.S.PixbufL, app.S.PixbufR
-	if app.Config.MangaMode {
+	if app.mangaMode() {
 		l, r = r, l
 	}
 
@@ -24,7 +24,6 @@ import (
 
 	"github.com/gotk3/gotk3/gtk"
 
-	"github.com/fauu/gomicsv/pagecache"
 	"github.com/fauu/gomicsv/util"
 )
 
@@ -88,11 +87,50 @@ func (jumpmarks *Jumpmarks) toggle(page int) bool {
 func (app *App) clearJumpmarks() {
 	// The following isn't needed until we use this function elsewhere than during archive closing, which we currently don't
 	// for _, mark := range app.S.Jumpmarks.list {
-	// 	app.S.PageCache.UnforbidRemoval(mark)
+	// 	app.S.PageCache.Unpin(mark - 1)
 	// }
 	app.S.Jumpmarks = Jumpmarks{}
 }
 
+// jumpmarkedPageNames returns the names of the marked pages of the current archive
+func (app *App) jumpmarkedPageNames() []string {
+	names := make([]string, 0, app.S.Jumpmarks.size())
+	for _, mark := range app.S.Jumpmarks.list {
+		name, _ := app.S.Archive.Name(mark - 1)
+		names = append(names, name)
+	}
+	return names
+}
+
+// relocateJumpmarks moves the marks back onto the pages with the given names after pages have been
+// added to or removed from the current archive. The marks of removed pages are dropped
+func (app *App) relocateJumpmarks(names []string) {
+	if len(names) == 0 {
+		return
+	}
+
+	pageOfName := make(map[string]int)
+	if l := app.S.Archive.Len(); l != nil {
+		for i := 0; i < *l; i++ {
+			if name, err := app.S.Archive.Name(i); err == nil {
+				pageOfName[name] = i + 1
+			}
+		}
+	}
+	list := make([]int, 0, len(names))
+	for _, name := range names {
+		if page, ok := pageOfName[name]; ok && name != "" {
+			list = append(list, page)
+		}
+	}
+	sort.Ints(list)
+
+	// The cycle refers to the positions in the old list
+	app.S.Jumpmarks = Jumpmarks{list: list}
+	app.jumpmarksHandleSetPage(app.S.ArchivePos + 1)
+	app.rebuildJumpmarksMenuList()
+}
+
 var jumpmarkMenuItems []*gtk.MenuItem
 
 func (app *App) currentPageIsJumpmarked() bool {
@@ -105,10 +143,10 @@ func (app *App) toggleJumpmark() {
 
 	var prefix string
 	if currentMarked {
-		app.S.PageCache.Keep(app.S.ArchivePos, pagecache.KeepReasonJumpmark)
+		app.S.PageCache.Pin(app.S.ArchivePos)
 		prefix = "Marked"
 	} else {
-		app.S.PageCache.DontKeep(app.S.ArchivePos, pagecache.KeepReasonJumpmark)
+		app.S.PageCache.Unpin(app.S.ArchivePos)
 		prefix = "Unmarked"
 	}
 	app.notificationShow(fmt.Sprintf("%s page %d", prefix, page), ShortNotification)
@@ -35,9 +35,16 @@ func (app *App) menuInit() {
 	app.menuInitOpenDialog()
 	app.menuInitOpenURLDialog()
 	app.menuInitSaveImageDialog()
+	app.passwordDialogInit()
+	app.urlTemplateDialogInit()
+	app.archiveInfoDialogInit()
+	app.editMetadataDialogInit()
 
 	app.W.MenuItemQuit.Connect("activate", app.quit)
 	app.W.MenuItemClose.Connect("activate", app.archiveClose)
+	app.W.MenuItemForgetPassword.Connect("activate", app.forgetCurrentArchivePassword)
+	app.W.MenuItemArchiveInfo.Connect("activate", app.archiveInfoDialogRun)
+	app.W.MenuItemEditMetadata.Connect("activate", app.editMetadataDialogRun)
 	app.W.MenuItemPreviousPage.Connect("activate", app.previousPage)
 	app.W.MenuItemNextPage.Connect("activate", app.nextPage)
 	app.W.MenuItemFirstPage.Connect("activate", app.firstPage)
@@ -80,13 +87,25 @@ func (app *App) menuInit() {
 	})
 
 	app.W.MenuItemMangaMode.Connect("toggled", func() {
-		app.setMangaMode(app.W.MenuItemMangaMode.GetActive())
+		active := app.W.MenuItemMangaMode.GetActive()
+		if active == app.mangaMode() {
+			// Only brought in line with a forced manga mode
+			return
+		}
+		app.S.MangaModeForced = false
+		app.setMangaMode(active)
 	})
 
 	app.W.MenuItemDoublePage.Connect("toggled", func() {
 		app.setDoublePage(app.W.MenuItemDoublePage.GetActive())
 	})
 
+	app.W.MenuItemAnimationPause.Connect("toggled", func() {
+		app.setAnimationPaused(app.W.MenuItemAnimationPause.GetActive())
+	})
+
+	app.W.MenuItemAnimationStep.Connect("activate", app.animationStep)
+
 	app.W.MenuItemOriginal.Connect("toggled", func() {
 		if app.W.MenuItemOriginal.GetActive() {
 			app.setZoomMode(Original)
@@ -135,6 +154,9 @@ func (app *App) menuInit() {
 
 	app.W.MenuItemJumpmarksReturnFromCycling.Connect("activate", app.returnFromCyclingJumpmarks)
 
+	app.W.MenuItemPreviousChapter.Connect("activate", app.previousChapter)
+	app.W.MenuItemNextChapter.Connect("activate", app.nextChapter)
+
 	app.W.MenuItemPreferences.Connect("activate", app.preferencesDialogRun)
 
 	app.W.MenuItemAbout.Connect("activate", func() {
@@ -209,7 +231,7 @@ func (app *App) menuInitOpenURLDialog() {
 			if err != nil {
 				log.Panicf("getting Open URL Dialog Referer Entry text: %v", err)
 			}
-			app.loadArchiveFromURL(url, referer)
+			app.openURL(url, referer)
 		}
 	})
 
@@ -304,6 +326,8 @@ func (app *App) menuSetupAccels() {
 				{&app.W.MenuItemVFlip.MenuItem, Accel{gdk.KEY_V, 0}},
 				{&app.W.MenuItemHFlip.MenuItem, Accel{gdk.KEY_V, gdk.SHIFT_MASK}},
 				{&app.W.MenuItemMangaMode.MenuItem, Accel{gdk.KEY_M, gdk.CONTROL_MASK}},
+				{&app.W.MenuItemAnimationPause.MenuItem, Accel{gdk.KEY_P, 0}},
+				{app.W.MenuItemAnimationStep, Accel{gdk.KEY_period, 0}},
 			},
 		},
 		{
@@ -336,6 +360,14 @@ func (app *App) menuSetupAccels() {
 				{app.W.MenuItemJumpmarksReturnFromCycling, Accel{gdk.KEY_BackSpace, 0}},
 			},
 		},
+		{
+			Menu: app.W.MenuChapters,
+			Path: menuMakeAccelPath("Chapters"),
+			Items: []MenuItemWithAccels{
+				{app.W.MenuItemPreviousChapter, Accel{gdk.KEY_Page_Up, gdk.MOD1_MASK}},
+				{app.W.MenuItemNextChapter, Accel{gdk.KEY_Page_Down, gdk.MOD1_MASK}},
+			},
+		},
 		{
 			Menu: app.W.MenuAbout,
 			Path: menuMakeAccelPath("About"),
@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gomicsv
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/gotk3/gotk3/gtk"
+
+	"github.com/fauu/gomicsv/archive"
+)
+
+const (
+	editMetadataPagesColumnNumber = iota
+	editMetadataPagesColumnName
+	editMetadataPagesColumnType
+)
+
+func (app *App) editMetadataDialogInit() {
+	_, err := app.W.EditMetadataDialog.AddButton("_Cancel", gtk.RESPONSE_CANCEL)
+	checkDialogAddButtonErr(err)
+	saveButton, err := app.W.EditMetadataDialog.AddButton("_Save", gtk.RESPONSE_ACCEPT)
+	checkDialogAddButtonErr(err)
+
+	app.W.EditMetadataDialog.SetDefault(saveButton)
+
+	app.W.EditMetadataPageTypeCellRenderer.Connect("edited", func(_ *gtk.CellRendererCombo, path string, text string) {
+		store := app.W.EditMetadataPagesListStore
+		iter, err := store.GetIterFromString(path)
+		if err != nil {
+			log.Printf("Error getting edited page row: %v", err)
+			return
+		}
+		if err := store.SetValue(iter, editMetadataPagesColumnType, text); err != nil {
+			log.Printf("Error setting page type: %v", err)
+		}
+	})
+}
+
+func (app *App) editMetadataDialogRun() {
+	if !app.archiveIsLoaded() || app.S.Archive == nil {
+		return
+	}
+	writer, ok := app.S.Archive.(archive.MetadataWriter)
+	if !ok {
+		return
+	}
+
+	// Edit a copy, so that nothing changes if writing fails
+	var metadata archive.ComicInfo
+	if current := app.archiveMetadata(); current != nil {
+		metadata = *current
+		metadata.Pages = append([]archive.ComicInfoPage{}, current.Pages...)
+	}
+
+	app.W.EditMetadataSeriesEntry.SetText(metadata.Series)
+	app.W.EditMetadataNumberEntry.SetText(metadata.Number)
+	app.W.EditMetadataVolumeEntry.SetText(metadata.Volume)
+	app.W.EditMetadataTitleEntry.SetText(metadata.Title)
+	if !app.W.EditMetadataReadingDirectionComboBox.SetActiveID(metadata.Manga) {
+		app.W.EditMetadataReadingDirectionComboBox.SetActiveID(archive.MangaUnknown)
+	}
+	app.editMetadataFillPages(&metadata)
+
+	res := gtk.ResponseType(app.W.EditMetadataDialog.Run())
+	app.W.EditMetadataDialog.Hide()
+	defer app.W.EditMetadataPagesListStore.Clear()
+	if res != gtk.RESPONSE_ACCEPT {
+		return
+	}
+
+	for _, field := range []struct {
+		value *string
+		entry *gtk.Entry
+	}{
+		{&metadata.Series, app.W.EditMetadataSeriesEntry},
+		{&metadata.Number, app.W.EditMetadataNumberEntry},
+		{&metadata.Volume, app.W.EditMetadataVolumeEntry},
+		{&metadata.Title, app.W.EditMetadataTitleEntry},
+	} {
+		text, err := field.entry.GetText()
+		if err != nil {
+			app.showError(fmt.Sprintf("Couldn't save the metadata: %v", err))
+			return
+		}
+		*field.value = text
+	}
+	manga := app.W.EditMetadataReadingDirectionComboBox.GetActiveID()
+	if manga != archive.MangaUnknown || metadata.Manga != "" {
+		metadata.Manga = manga
+	}
+
+	store := app.W.EditMetadataPagesListStore
+	iter, ok := store.GetIterFirst()
+	for i := 0; ok; i, ok = i+1, store.IterNext(iter) {
+		value, err := store.GetValue(iter, editMetadataPagesColumnType)
+		if err != nil {
+			// The page keeps its current type
+			log.Printf("Error getting the type of page %d: %v", i+1, err)
+			continue
+		}
+		pageType, _ := value.GetString()
+		metadata.SetPageType(i, pageType)
+	}
+
+	if err := writer.WriteMetadata(&metadata); err != nil {
+		app.showError(fmt.Sprintf("Couldn't save the metadata: %v", err))
+		return
+	}
+	app.notificationShow("Metadata saved", ShortNotification)
+}
+
+func (app *App) editMetadataFillPages(metadata *archive.ComicInfo) {
+	store := app.W.EditMetadataPagesListStore
+	store.Clear()
+
+	if app.S.Archive.Len() == nil {
+		return
+	}
+
+	for i := 0; i < *app.S.Archive.Len(); i++ {
+		name, _ := app.S.Archive.Name(i)
+		pageType := ""
+		if page := metadata.Page(i); page != nil {
+			pageType = page.Type
+		}
+		err := store.Set(
+			store.Append(),
+			[]int{editMetadataPagesColumnNumber, editMetadataPagesColumnName, editMetadataPagesColumnType},
+			[]interface{}{i + 1, name, pageType},
+		)
+		if err != nil {
+			log.Printf("Error setting page row: %v", err)
+		}
+	}
+}
@@ -41,7 +41,7 @@ func (app *App) randomPage() {
 }
 
 func (app *App) isNavigationRightToLeft() bool {
-	return app.Config.MangaMode && !app.Config.MangaModeReverseNavigation
+	return app.mangaMode() && !app.Config.MangaModeReverseNavigation
 }
 
 func (app *App) pageLeft() {
@@ -131,15 +131,15 @@ func (app *App) previousPage() {
 		return
 	}
 
-	app.setPage(app.S.ArchivePos - n)
+	app.setPageThen(app.S.ArchivePos-n, func() {
+		if app.Config.DoublePage &&
+			app.shouldForceSinglePage() &&
+			app.S.Archive.Len() != nil &&
+			*app.S.Archive.Len()-app.S.ArchivePos > 1 {
 
-	if app.Config.DoublePage &&
-		app.shouldForceSinglePage() &&
-		app.S.Archive.Len() != nil &&
-		*app.S.Archive.Len()-app.S.ArchivePos > 1 {
-
-		app.nextPage()
-	}
+			app.nextPage()
+		}
+	})
 }
 
 func (app *App) nextPage() {
@@ -203,7 +203,7 @@ func (app *App) imageHash(n int) (imgdiff.Hash, bool) {
 		return hash, true
 	}
 
-	pixbuf, err := app.S.Archive.Load(n, app.Config.EmbeddedOrientation, 0)
+	pixbuf, err := app.loadPage(n, 0)
 	if err != nil {
 		app.showError(err.Error())
 		return 0, false
@@ -332,6 +332,10 @@ func (app *App) previousScene() {
 
 // TODO(fau): Distinguish a failiure from the "no next archive" condition and inform the user accordingly
 func (app *App) nextArchive() bool {
+	if linked, ok := app.S.Archive.(archive.Linked); ok && app.archiveIsLoaded() {
+		return app.loadLinkedArchive(linked.NextURL(), nil)
+	}
+
 	newName, err := app.archiveNameRelativeToCurrent(1)
 	if err != nil {
 		log.Printf("Error getting next archive: %v", err)
@@ -344,6 +348,10 @@ func (app *App) nextArchive() bool {
 
 // TODO(fau): Distinguish a failiure from the "no previous archive" condition and inform the user accordingly
 func (app *App) previousArchive() bool {
+	if linked, ok := app.S.Archive.(archive.Linked); ok && app.archiveIsLoaded() {
+		return app.loadLinkedArchive(linked.PreviousURL(), app.lastPage)
+	}
+
 	newName, err := app.archiveNameRelativeToCurrent(-1)
 	if err != nil {
 		log.Printf("Error getting previous archive: %v", err)
@@ -355,21 +363,38 @@ func (app *App) previousArchive() bool {
 	return true
 }
 
-// currentArchiveIdx determines the index of the current archive in the directory. We need to do
-// this every time, since the filesystem is mutable
-func (app *App) currentArchiveIdx() (idx int, err error) {
-	dir, name := filepath.Split(app.S.ArchivePath)
-	if dir == "" {
-		dir, err = os.Getwd()
+// loadLinkedArchive opens the archive at the URL the current one links to, such as the next
+// chapter on a website, with the same referer, calling then once it's loaded
+func (app *App) loadLinkedArchive(url string, then func()) bool {
+	if url == "" {
+		return false
+	}
+	app.loadArchiveFromURLThen(url, app.S.HTTPReferer, then)
+	return true
+}
+
+// archiveSiblings lists the archives next to the current one, i.e. the archives in its directory
+// or, for an archive nested inside another one, in the container. We need to do this every time,
+// since the filesystem is mutable
+func (app *App) archiveSiblings() (parent string, names []string, current string, err error) {
+	if container, inner, ok := archive.SplitNestedPath(app.S.ArchivePath); ok {
+		names, err = archive.ListNested(container)
+		return container, names, inner, err
+	}
+
+	parent, current = filepath.Split(app.S.ArchivePath)
+	if parent == "" {
+		parent, err = os.Getwd()
 		if err != nil {
 			return
 		}
 	}
-	arNames, err := archive.ListInDirectory(dir)
-	if err != nil {
-		return
-	}
+	names, err = archive.ListInDirectory(parent)
+	return
+}
 
+// currentArchiveIdx determines the index of the current archive among arNames
+func currentArchiveIdx(arNames []string, name string) (idx int, err error) {
 	idx = -1
 	for i := 0; i < len(arNames); i++ {
 		if arNames[i] == name {
@@ -382,23 +407,16 @@ func (app *App) currentArchiveIdx() (idx int, err error) {
 	return
 }
 
-// archiveNameRelativeToCurrent gets the name of the archive in the current directory whose
-// relative position with regards to the current archive is equal to relIdx
+// archiveNameRelativeToCurrent gets the name of the sibling archive whose relative position with
+// regards to the current archive is equal to relIdx
 // TODO(utkan): Use inotify to avoid obtaining list from the scratch all the time
 func (app *App) archiveNameRelativeToCurrent(relIdx int) (newName string, err error) {
-	dir, _ := filepath.Split(app.S.ArchivePath)
-	if dir == "" {
-		dir, err = os.Getwd()
-		if err != nil {
-			return
-		}
-	}
-	arNames, err := archive.ListInDirectory(dir)
+	parent, arNames, current, err := app.archiveSiblings()
 	if err != nil {
 		return
 	}
 
-	currIdx, err := app.currentArchiveIdx()
+	currIdx, err := currentArchiveIdx(arNames, current)
 	if err != nil {
 		return "", nil
 	}
@@ -409,6 +427,6 @@ func (app *App) archiveNameRelativeToCurrent(relIdx int) (newName string, err er
 		return
 	}
 
-	newName = filepath.Join(dir, arNames[idx])
+	newName = filepath.Join(parent, filepath.FromSlash(arNames[idx]))
 	return
 }
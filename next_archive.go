@@ -0,0 +1,149 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gomicsv
+
+import (
+	"context"
+	"log"
+
+	"github.com/fauu/gomicsv/archive"
+	"github.com/fauu/gomicsv/pagecache"
+)
+
+// When seamlessly reading, the next archive is opened in the background once there are at most
+// this many pages left in the current one
+const nextArchivePrepareWithin = 5
+
+// preparedArchive is an archive opened in the background, together with a page cache holding its
+// first pages decoded. Until the archive is taken, the cache is limited to what the current one
+// leaves of the budget
+type preparedArchive struct {
+	path   string
+	ar     archive.Archive // Valid once opened is closed. Nil if opening failed
+	cache  *pagecache.PageCache
+	opened chan struct{}
+	done   chan struct{} // Closed once the preparation is finished
+	cancel context.CancelFunc
+}
+
+// nextArchivePrepare starts opening the archive following the current one, when reading
+// seamlessly and close to the end, so that moving on to it doesn't involve waiting
+func (app *App) nextArchivePrepare() {
+	if !app.Config.Seamless || app.S.NextArchive != nil || app.S.Archive.Kind() == archive.HTTPKind {
+		return
+	}
+	l := app.S.Archive.Len()
+	if l == nil || *l-app.S.ArchivePos > nextArchivePrepareWithin {
+		return
+	}
+
+	path, err := app.archiveNameRelativeToCurrent(1)
+	if err != nil || path == "" {
+		return
+	}
+	path = archive.FirstNestedVolumePath(archive.FirstVolumePath(path))
+	if archive.IsImagePath(path) {
+		return
+	}
+
+	opts := app.archiveOptions("")
+	// A password, if needed and not saved, will be asked for once the archive is actually opened
+	if password, ok := app.loadSavedPassword(path); ok {
+		opts.Password = password
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &preparedArchive{
+		path:   path,
+		cache:  pagecache.NewPageCache(app.S.PageCache.RemainingBudget()),
+		opened: make(chan struct{}),
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+	app.S.NextArchive = p
+
+	start := app.archiveStartPage(path, false)
+	n := max(app.Config.NPreload, 1)
+	if app.Config.DoublePage {
+		n *= 2
+	}
+	autorotate := app.Config.EmbeddedOrientation
+	go func() {
+		defer close(p.done)
+
+		ar, err := archive.NewArchive(path, opts)
+		if err != nil {
+			log.Printf("Couldn't open the next archive in advance: %v", err)
+			close(p.opened)
+			return
+		}
+		p.ar = ar
+		close(p.opened)
+
+		for i := start; i < start+n; i++ {
+			if l := ar.Len(); ctx.Err() != nil || (l != nil && i >= *l) {
+				return
+			}
+			// Errors will be reported once the page is actually viewed
+			decodePage(ctx, ar, p.cache, i, 0, autorotate)
+		}
+	}()
+}
+
+// nextArchiveTake returns the archive at path if it has already been opened in advance, or nil.
+// The decoding of its first pages continues until cancelled with prefetchCancel
+func (app *App) nextArchiveTake(path string) *preparedArchive {
+	p := app.S.NextArchive
+	if p == nil || p.path != path {
+		return nil
+	}
+
+	select {
+	case <-p.opened:
+	default:
+		// Opening it normally won't take longer than waiting
+		app.nextArchiveDiscard()
+		return nil
+	}
+	app.S.NextArchive = nil
+
+	if p.ar == nil {
+		p.cancel()
+		return nil
+	}
+	p.cache.SetBudget(app.Config.PageCacheSize)
+	return p
+}
+
+// nextArchiveDiscard drops the archive opened in advance, if there is one
+func (app *App) nextArchiveDiscard() {
+	p := app.S.NextArchive
+	if p == nil {
+		return
+	}
+	app.S.NextArchive = nil
+
+	p.cancel()
+	go func() {
+		<-p.done
+		if p.ar != nil {
+			p.ar.Close()
+		}
+	}()
+}
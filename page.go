@@ -19,23 +19,33 @@
 package gomicsv
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"sort"
-	"strings"
-	"time"
 
+	"github.com/fauu/gomicsv/archive"
 	"github.com/fauu/gomicsv/pagecache"
+	"github.com/fauu/gomicsv/pixbuf"
 	"github.com/fauu/gomicsv/util"
+	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/glib"
 )
 
-const (
-	pageCacheTrimInterval       = 3 * time.Minute
-	preloadedPageKeepAtLeastFor = 7 * time.Minute
-)
+// The spinner is only shown for loads taking longer than this, not to have it flash
+const pageSpinnerDelayMs = 150
+
+func (app *App) pageInit() {
+	app.W.PagePlaceholderRetryButton.Connect("clicked", func() {
+		app.doSetPage(app.S.ArchivePos)
+	})
+}
 
 func (app *App) setPage(n int) {
+	app.setPageThen(n, nil)
+}
+
+// setPageThen goes to page n, calling then once it has been displayed
+func (app *App) setPageThen(n int, then func()) {
 	if !app.archiveIsLoaded() {
 		return
 	}
@@ -57,85 +67,199 @@ func (app *App) setPage(n int) {
 		isPrev = true
 	}
 
-	app.doSetPage(n)
-
 	var scrollFunc func()
 	if isPrev {
 		scrollFunc = app.scrollToEnd
 	} else {
 		scrollFunc = app.scrollToStart
 	}
-	glib.TimeoutAdd(0, scrollFunc)
+	app.doSetPageThen(n, func() {
+		glib.TimeoutAdd(0, scrollFunc)
+		if then != nil {
+			then()
+		}
+	})
 }
 
 func (app *App) doSetPage(n int) {
+	app.doSetPageThen(n, nil)
+}
+
+// doSetPageThen displays the view starting at page n, calling then afterwards. Pages missing from
+// the page cache are loaded in the background, with the current ones displayed in the meantime.
+// ArchivePos changes right away, so that navigating further supersedes the load
+func (app *App) doSetPageThen(n int, then func()) {
 	if !app.archiveIsLoaded() {
 		return
 	}
 
-	app.jumpmarksHandleSetPage(n - 1)
+	app.pageLoadCancel()
 
-	var err error
-	app.S.PixbufL, err = app.S.Archive.Load(n, app.Config.EmbeddedOrientation, app.Config.NPreload)
-	if err != nil {
-		app.showError(err.Error())
-		return
-	}
+	app.jumpmarksHandleSetPage(n - 1)
 
 	app.S.ArchivePos = n
+	app.chaptersHandleSetPage(n)
 
-	app.S.PixbufR = nil
-	if app.Config.DoublePage && (app.S.Archive.Len() == nil || *app.S.Archive.Len() > n+1) {
-		app.S.PixbufR, err = app.S.Archive.Load(n+1, app.Config.EmbeddedOrientation, app.Config.NPreload)
-		if err != nil {
-			app.showError(err.Error())
+	withR := app.Config.DoublePage && (app.S.Archive.Len() == nil || *app.S.Archive.Len() > n+1)
+
+	if l, ok := app.S.PageCache.Get(n); ok {
+		var r *gdk.Pixbuf
+		if withR {
+			r, ok = app.S.PageCache.Get(n + 1)
+		}
+		if ok {
+			app.showPages(n, l, r, then)
 			return
 		}
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	app.S.PageLoadCancel = cancel
+	app.pageSpinnerSchedule()
+
+	ar, cache, nPreload, autorotate := app.S.Archive, app.S.PageCache, app.Config.NPreload, app.Config.EmbeddedOrientation
+	go func() {
+		var r *gdk.Pixbuf
+		failed := n
+		l, err := decodePage(ctx, ar, cache, n, nPreload, autorotate)
+		if err == nil && withR {
+			failed = n + 1
+			r, err = decodePage(ctx, ar, cache, n+1, nPreload, autorotate)
+			if errors.Is(err, archive.ErrBounds) {
+				// Page n has turned out to be the last one
+				r, err = nil, nil
+			}
+		}
+
+		glib.IdleAdd(func() bool {
+			// Cancelled loads have been superseded
+			if ctx.Err() != nil {
+				return false
+			}
+			app.pageLoadCancel()
+
+			if err != nil {
+				if !app.retryRemovedPage(n, err) && !app.returnFromPastEnd(n, err) {
+					app.showPagePlaceholder(failed, err)
+				}
+				return false
+			}
+			app.showPages(n, l, r, then)
+			return false
+		})
+	}()
+}
+
+// showPages displays the view starting at page n, consisting of the pages l and r
+func (app *App) showPages(n int, l, r *gdk.Pixbuf, then func()) {
+	app.S.PixbufL, app.S.PixbufR = l, r
+	app.W.PagePlaceholder.Hide()
+
+	app.animationsStart()
+
 	util.GC()
 
 	app.blit()
 	app.updateStatus()
-}
+	app.prefetchAround(n)
+	app.nextArchivePrepare()
 
-func (app *App) trimPageCache() {
-	if app.S.PageCache == nil {
-		return
+	if then != nil {
+		then()
 	}
+}
 
-	// Mark pages as no longer needed for preload unless they're recently fetched or near the current page
-	var preloadDontKeep []int
-	nearKeepStart := app.S.ArchivePos - app.Config.NPreload
-	nearKeepEnd := app.S.ArchivePos + app.Config.NPreload
-	for i, entry := range app.S.PageCache.Pages {
-		if time.Since(entry.Time) > preloadedPageKeepAtLeastFor && (i < nearKeepStart || i > nearKeepEnd) {
-			preloadDontKeep = append(preloadDontKeep, i)
-		}
+// showPagePlaceholder displays, in place of the current view, the error page i couldn't be loaded
+// with and a button to try again
+func (app *App) showPagePlaceholder(i int, err error) {
+	app.animationsStop()
+	app.S.PixbufL, app.S.PixbufR = nil, nil
+	app.W.ImageL.Clear()
+	app.W.ImageR.Clear()
+
+	app.W.PagePlaceholderLabel.SetText(fmt.Sprintf("Couldn't load page %d: %v", i+1, err))
+	app.W.PagePlaceholder.Show()
+
+	app.prefetchAround(app.S.ArchivePos)
+}
+
+// pageSpinnerSchedule shows the loading spinner if the page load is still in progress after
+// a moment
+func (app *App) pageSpinnerSchedule() {
+	handle := glib.TimeoutAdd(pageSpinnerDelayMs, func() bool {
+		app.S.PageSpinnerTimeout = nil
+		app.W.PageSpinner.Show()
+		app.W.PageSpinner.Start()
+		return false
+	})
+	app.S.PageSpinnerTimeout = &handle
+}
+
+// pageLoadCancel abandons the page load in progress. Returns whether there was one
+func (app *App) pageLoadCancel() bool {
+	if app.S.PageLoadCancel == nil {
+		return false
 	}
-	if len(preloadDontKeep) > 0 {
-		app.S.PageCache.DontKeepSlice(preloadDontKeep, pagecache.KeepReasonPreload)
+	app.S.PageLoadCancel()
+	app.S.PageLoadCancel = nil
+
+	if app.S.PageSpinnerTimeout != nil {
+		glib.SourceRemove(*app.S.PageSpinnerTimeout)
+		app.S.PageSpinnerTimeout = nil
 	}
+	app.W.PageSpinner.Stop()
+	app.W.PageSpinner.Hide()
+	return true
+}
 
-	// Trim unneeded pages
-	app.S.PageCache.Trim()
+// loadPage returns page i of the current archive decoded, going through the page cache
+func (app *App) loadPage(i int, nPreload int) (*gdk.Pixbuf, error) {
+	return decodePage(context.Background(), app.S.Archive, app.S.PageCache, i, nPreload, app.Config.EmbeddedOrientation)
+}
 
-	// Log cache status
-	var indices []int
-	for i := range app.S.PageCache.Pages {
-		indices = append(indices, i+1)
+// decodePage returns page i of ar decoded, going through cache. Safe to call from any goroutine
+func decodePage(ctx context.Context, ar archive.Archive, cache *pagecache.PageCache, i int, nPreload int, autorotate bool) (*gdk.Pixbuf, error) {
+	if pixbuf, ok := cache.Get(i); ok {
+		return pixbuf, nil
 	}
-	sort.Ints(indices)
-	var strIndices []string
-	for _, index := range indices {
-		strIndices = append(strIndices, fmt.Sprint(index))
+
+	page, err := ar.Load(ctx, i, nPreload)
+	if err != nil {
+		return nil, err
+	}
+	pixbuf, err := pixbuf.Decode(page.Data, autorotate)
+	if err != nil {
+		return nil, err
 	}
 
-	var remainingStr string
-	if len(strIndices) == 0 {
-		remainingStr = "-"
-	} else {
-		remainingStr = strings.Join(strIndices, ", ")
+	cache.Insert(i, pixbuf)
+	return pixbuf, nil
+}
+
+// returnFromPastEnd goes back to the last page if err signifies that page n has turned out to be
+// past the end of an archive whose length wasn't known
+func (app *App) returnFromPastEnd(n int, err error) bool {
+	l := app.S.Archive.Len()
+	if !errors.Is(err, archive.ErrBounds) || l == nil || *l == 0 || n < *l {
+		return false
 	}
-	log.Printf("Trimmed page cache. Remaining pages: %s", remainingStr)
+	app.notificationShow("No more pages", ShortNotification)
+	app.doSetPage(*l - 1)
+	return true
+}
+
+// retryRemovedPage goes to page n (or the last page if there are no longer as many) again if err
+// signifies that a page has been removed from the archive in the meantime
+func (app *App) retryRemovedPage(n int, err error) bool {
+	if !errors.Is(err, archive.ErrPageRemoved) || !app.syncArchive() {
+		return false
+	}
+	if l := app.S.Archive.Len(); l != nil {
+		if *l == 0 {
+			return false
+		}
+		n = min(n, *l-1)
+	}
+	app.doSetPage(n)
+	return true
 }
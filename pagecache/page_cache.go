@@ -19,120 +19,174 @@
 package pagecache
 
 import (
+	"container/list"
 	"sync"
-	"time"
 
-	"github.com/fauu/gomicsv/util"
 	"github.com/gotk3/gotk3/gdk"
 )
 
-type KeepReason uint8
-
-const (
-	KeepReasonPreload KeepReason = 1 << iota
-	KeepReasonJumpmark
-)
+const bytesPerMB = 1024 * 1024
 
+// PageCache keeps the decoded pages of an archive, evicting the least recently used ones once
+// their total size exceeds the budget. Pinned pages are never evicted. Safe for concurrent use
 type PageCache struct {
-	Pages      map[int]CachedPage
-	pagesMutex sync.Mutex
-	keep       map[int]KeepReason
-	keepMutex  sync.Mutex
-}
-
-func NewPageCache() PageCache {
-	return PageCache{
-		make(map[int]CachedPage),
-		sync.Mutex{},
-		make(map[int]KeepReason),
-		sync.Mutex{},
-	}
+	mutex  sync.Mutex
+	budget int64 // In bytes
+	size   int64
+	pages  map[int]*list.Element
+	lru    *list.List // Of *cachedPage, the most recently used first
+	pinned map[int]bool
+	stats  Stats
 }
 
-type CachedPage struct {
-	Pixbuf *gdk.Pixbuf
-	Time   time.Time
+type cachedPage struct {
+	i      int
+	pixbuf *gdk.Pixbuf
+	size   int64
 }
 
-func NewCachedPage(pixbuf *gdk.Pixbuf) CachedPage {
-	return CachedPage{pixbuf, time.Now()}
+// Stats are the counters of the cache's activity together with its current contents
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Pages     int
+	Size      int64 // In bytes
 }
 
-func (cache *PageCache) Get(i int) (*CachedPage, bool) {
-	cache.pagesMutex.Lock()
-	defer cache.pagesMutex.Unlock()
-	if page, ok := cache.Pages[i]; ok {
-		return &page, true
-	} else {
-		return nil, false
+func NewPageCache(budgetMB int) *PageCache {
+	return &PageCache{
+		budget: int64(budgetMB) * bytesPerMB,
+		pages:  make(map[int]*list.Element),
+		lru:    list.New(),
+		pinned: make(map[int]bool),
 	}
 }
 
-func (cache *PageCache) Insert(i int, pixbuf *gdk.Pixbuf, keepReason KeepReason) {
-	cache.set(i, pixbuf)
-	cache.Keep(i, keepReason)
+func (cache *PageCache) Get(i int) (*gdk.Pixbuf, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	el, ok := cache.pages[i]
+	if !ok {
+		cache.stats.Misses++
+		return nil, false
+	}
+	cache.stats.Hits++
+	cache.lru.MoveToFront(el)
+	return el.Value.(*cachedPage).pixbuf, true
 }
 
-func (cache *PageCache) Keep(i int, reason KeepReason) {
-	cache.keepMutex.Lock()
-	defer cache.keepMutex.Unlock()
-	cache.keep[i] |= reason
+// Contains reports whether page i is cached, without counting as its use
+func (cache *PageCache) Contains(i int) bool {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	_, ok := cache.pages[i]
+	return ok
 }
 
-func (cache *PageCache) DontKeep(i int, reason KeepReason) {
-	cache.keepMutex.Lock()
-	defer cache.keepMutex.Unlock()
-	cache.doDontKeep(i, reason)
+// Insert caches page i as the most recently used one, replacing its previous version
+func (cache *PageCache) Insert(i int, pixbuf *gdk.Pixbuf) {
+	cache.insert(i, pixbuf, pixbufSize(pixbuf))
 }
 
-func (cache *PageCache) DontKeepSlice(indices []int, reason KeepReason) {
-	cache.keepMutex.Lock()
-	defer cache.keepMutex.Unlock()
-	for _, i := range indices {
-		cache.doDontKeep(i, reason)
+func (cache *PageCache) insert(i int, pixbuf *gdk.Pixbuf, size int64) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if el, ok := cache.pages[i]; ok {
+		cache.remove(el)
 	}
+	page := &cachedPage{i: i, pixbuf: pixbuf, size: size}
+	cache.pages[i] = cache.lru.PushFront(page)
+	cache.size += page.size
+	cache.evict()
 }
 
-func (cache *PageCache) doDontKeep(i int, reason KeepReason) {
-	keep, ok := cache.keep[i]
-	if !ok {
-		return
-	}
-	keep &^= reason
-	if keep == 0 {
-		delete(cache.keep, i)
-	} else {
-		cache.keep[i] = keep
-	}
+// Pin exempts page i from eviction, whether it's already cached or not
+func (cache *PageCache) Pin(i int) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.pinned[i] = true
+}
+
+func (cache *PageCache) Unpin(i int) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	delete(cache.pinned, i)
+	cache.evict()
 }
 
-func (cache *PageCache) Trim() {
-	var toRemove []int
-	for i := range cache.Pages {
-		if cache.keep[i] == 0 {
-			toRemove = append(toRemove, i)
+// Reindex moves the cached and pinned pages to the indices returned by reindex, dropping those for
+// which it returns false
+func (cache *PageCache) Reindex(reindex func(i int) (int, bool)) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	pages := make(map[int]*list.Element, len(cache.pages))
+	for i, el := range cache.pages {
+		page := el.Value.(*cachedPage)
+		j, ok := reindex(i)
+		if !ok {
+			cache.lru.Remove(el)
+			cache.size -= page.size
+			continue
 		}
+		page.i = j
+		pages[j] = el
 	}
-	if len(toRemove) > 0 {
-		cache.remove(toRemove)
+	cache.pages = pages
+
+	pinned := make(map[int]bool, len(cache.pinned))
+	for i := range cache.pinned {
+		if j, ok := reindex(i); ok {
+			pinned[j] = true
+		}
 	}
+	cache.pinned = pinned
 }
 
-func (cache *PageCache) set(i int, pixbuf *gdk.Pixbuf) {
-	cache.pagesMutex.Lock()
-	defer cache.pagesMutex.Unlock()
-	if pixbuf == nil {
-		delete(cache.Pages, i)
-	} else {
-		cache.Pages[i] = NewCachedPage(pixbuf)
-	}
+func (cache *PageCache) SetBudget(budgetMB int) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.budget = int64(budgetMB) * bytesPerMB
+	cache.evict()
+}
+
+// RemainingBudget returns how much of the budget, in MB, the cached pages leave unused
+func (cache *PageCache) RemainingBudget() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return int(max(cache.budget-cache.size, 0) / bytesPerMB)
+}
+
+func (cache *PageCache) Stats() Stats {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	stats := cache.stats
+	stats.Pages = len(cache.pages)
+	stats.Size = cache.size
+	return stats
 }
 
-func (cache *PageCache) remove(indices []int) {
-	cache.pagesMutex.Lock()
-	defer cache.pagesMutex.Unlock()
-	for _, i := range indices {
-		delete(cache.Pages, i)
+// evict removes the least recently used unpinned pages until the cache fits within the budget. The
+// most recently used page is kept regardless, since it's likely the one being displayed
+func (cache *PageCache) evict() {
+	el := cache.lru.Back()
+	for el != nil && el != cache.lru.Front() && cache.size > cache.budget {
+		prev := el.Prev()
+		if !cache.pinned[el.Value.(*cachedPage).i] {
+			cache.remove(el)
+			cache.stats.Evictions++
+		}
+		el = prev
 	}
-	util.GC()
+}
+
+func (cache *PageCache) remove(el *list.Element) {
+	page := cache.lru.Remove(el).(*cachedPage)
+	delete(cache.pages, page.i)
+	cache.size -= page.size
+}
+
+func pixbufSize(pixbuf *gdk.Pixbuf) int64 {
+	return int64(pixbuf.GetRowstride()) * int64(pixbuf.GetHeight())
 }
@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package pagecache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPageCache(t *testing.T) {
+	type op func(cache *PageCache)
+	insert := func(i int, sizeMB int64) op {
+		return func(cache *PageCache) { cache.insert(i, nil, sizeMB*bytesPerMB) }
+	}
+	get := func(i int) op {
+		return func(cache *PageCache) { cache.Get(i) }
+	}
+	pin := func(i int) op {
+		return func(cache *PageCache) { cache.Pin(i) }
+	}
+	unpin := func(i int) op {
+		return func(cache *PageCache) { cache.Unpin(i) }
+	}
+	setBudget := func(budgetMB int) op {
+		return func(cache *PageCache) { cache.SetBudget(budgetMB) }
+	}
+	// Page 1 removed
+	removeOne := func(cache *PageCache) {
+		cache.Reindex(func(i int) (int, bool) {
+			if i > 1 {
+				return i - 1, true
+			}
+			return i, i != 1
+		})
+	}
+
+	for _, tc := range []struct {
+		name     string
+		budgetMB int
+		ops      []op
+		cached   []int
+		stats    Stats
+	}{
+		{
+			name:     "within budget",
+			budgetMB: 3,
+			ops:      []op{insert(0, 1), insert(1, 1), insert(2, 1)},
+			cached:   []int{0, 1, 2},
+			stats:    Stats{Pages: 3, Size: 3 * bytesPerMB},
+		},
+		{
+			name:     "least recently used evicted",
+			budgetMB: 2,
+			ops:      []op{insert(0, 1), insert(1, 1), get(0), insert(2, 1)},
+			cached:   []int{0, 2},
+			stats:    Stats{Hits: 1, Evictions: 1, Pages: 2, Size: 2 * bytesPerMB},
+		},
+		{
+			name:     "most recently used kept over budget",
+			budgetMB: 1,
+			ops:      []op{insert(0, 1), insert(1, 3)},
+			cached:   []int{1},
+			stats:    Stats{Evictions: 1, Pages: 1, Size: 3 * bytesPerMB},
+		},
+		{
+			name:     "pinned kept",
+			budgetMB: 2,
+			ops:      []op{pin(0), insert(0, 1), insert(1, 1), insert(2, 1)},
+			cached:   []int{0, 2},
+			stats:    Stats{Evictions: 1, Pages: 2, Size: 2 * bytesPerMB},
+		},
+		{
+			name:     "unpinned evicted",
+			budgetMB: 1,
+			ops:      []op{pin(0), insert(0, 1), insert(1, 1), unpin(0)},
+			cached:   []int{1},
+			stats:    Stats{Evictions: 1, Pages: 1, Size: 1 * bytesPerMB},
+		},
+		{
+			name:     "budget shrunk",
+			budgetMB: 3,
+			ops:      []op{insert(0, 1), insert(1, 1), insert(2, 1), pin(1), setBudget(1)},
+			cached:   []int{1, 2},
+			stats:    Stats{Evictions: 1, Pages: 2, Size: 2 * bytesPerMB},
+		},
+		{
+			name:     "reindexed",
+			budgetMB: 3,
+			ops:      []op{insert(0, 1), insert(1, 1), insert(2, 1), removeOne},
+			cached:   []int{0, 1},
+			stats:    Stats{Pages: 2, Size: 2 * bytesPerMB},
+		},
+		{
+			name:     "reindexed pinned",
+			budgetMB: 1,
+			ops:      []op{pin(3), insert(3, 1), removeOne, insert(0, 1)},
+			cached:   []int{0, 2},
+			stats:    Stats{Pages: 2, Size: 2 * bytesPerMB},
+		},
+		{
+			name:     "hits and misses",
+			budgetMB: 1,
+			ops:      []op{get(0), insert(0, 1), get(0), get(0), get(1)},
+			cached:   []int{0},
+			stats:    Stats{Hits: 2, Misses: 2, Pages: 1, Size: 1 * bytesPerMB},
+		},
+		{
+			name:     "reinserted replaced",
+			budgetMB: 2,
+			ops:      []op{insert(0, 1), insert(0, 2)},
+			cached:   []int{0},
+			stats:    Stats{Pages: 1, Size: 2 * bytesPerMB},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cache := NewPageCache(tc.budgetMB)
+			for _, op := range tc.ops {
+				op(cache)
+			}
+
+			var cached []int
+			for i := 0; i < 10; i++ {
+				if cache.Contains(i) {
+					cached = append(cached, i)
+				}
+			}
+			if !reflect.DeepEqual(cached, tc.cached) {
+				t.Errorf("cached pages = %v, want %v", cached, tc.cached)
+			}
+			if stats := cache.Stats(); stats != tc.stats {
+				t.Errorf("Stats() = %+v, want %+v", stats, tc.stats)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gomicsv
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// Passwords for encrypted archives are optionally remembered per archive path, each in its own
+// file inside the user data directory
+
+func (app *App) loadSavedPassword(archivePath string) (string, bool) {
+	data, err := os.ReadFile(app.passwordFilePath(archivePath))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading saved password: %v", err)
+		}
+		return "", false
+	}
+	return string(data), true
+}
+
+func (app *App) savePassword(archivePath string, password string) {
+	passwordFilePath := app.passwordFilePath(archivePath)
+	if err := os.WriteFile(passwordFilePath, []byte(password), 0600); err != nil {
+		log.Printf("Error writing password file '%s': %v", passwordFilePath, err)
+	}
+}
+
+func (app *App) forgetPassword(archivePath string) {
+	passwordFilePath := app.passwordFilePath(archivePath)
+	if err := os.Remove(passwordFilePath); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error removing password file '%s': %v", passwordFilePath, err)
+	}
+}
+
+func (app *App) passwordFilePath(archivePath string) string {
+	filename := strings.ToUpper(md5String(archivePath))
+	return filepath.Join(app.S.PasswordsDirPath, filename)
+}
+
+func (app *App) forgetCurrentArchivePassword() {
+	if !app.archiveIsLoaded() {
+		return
+	}
+	app.forgetPassword(app.S.ArchivePath)
+	app.updateForgetPasswordMenuItem()
+	app.notificationShow("Forgot the saved password", ShortNotification)
+}
+
+func (app *App) updateForgetPasswordMenuItem() {
+	saved := false
+	if app.archiveIsLoaded() {
+		_, saved = app.loadSavedPassword(app.S.ArchivePath)
+	}
+	app.W.MenuItemForgetPassword.SetSensitive(saved)
+}
+
+func (app *App) passwordDialogInit() {
+	_, err := app.W.PasswordDialog.AddButton("_Cancel", gtk.RESPONSE_CANCEL)
+	checkDialogAddButtonErr(err)
+	okButton, err := app.W.PasswordDialog.AddButton("_OK", gtk.RESPONSE_ACCEPT)
+	checkDialogAddButtonErr(err)
+
+	app.W.PasswordDialog.SetDefault(okButton)
+}
+
+// passwordDialogRun asks the user for the password to the given archive. ok is false if the user
+// cancelled
+func (app *App) passwordDialogRun(archiveName string, retry bool) (password string, remember bool, ok bool) {
+	var prompt string
+	if retry {
+		prompt = fmt.Sprintf("Incorrect password for “%s”. Try again:", archiveName)
+	} else {
+		prompt = fmt.Sprintf("“%s” is password-protected. Enter the password:", archiveName)
+	}
+	app.W.PasswordDialogPromptLabel.SetText(prompt)
+	app.W.PasswordDialogEntry.SetText("")
+	app.W.PasswordDialogEntry.GrabFocus()
+
+	app.S.Cursor.ForceVisible = true
+	res := gtk.ResponseType(app.W.PasswordDialog.Run())
+	app.W.PasswordDialog.Hide()
+	app.S.Cursor.ForceVisible = false
+	if res != gtk.RESPONSE_ACCEPT {
+		return "", false, false
+	}
+
+	password, err := app.W.PasswordDialogEntry.GetText()
+	if err != nil {
+		log.Panicf("getting Password Dialog Entry text: %v", err)
+	}
+	app.W.PasswordDialogEntry.SetText("")
+	return password, app.W.PasswordDialogRememberCheckButton.GetActive(), true
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gomicsv
+
+import "testing"
+
+func TestSavedPassword(t *testing.T) {
+	app := &App{}
+	app.S.PasswordsDirPath = t.TempDir()
+
+	if _, ok := app.loadSavedPassword("/comics/a.cbr"); ok {
+		t.Fatal("a password is saved before saving any")
+	}
+
+	app.savePassword("/comics/a.cbr", "secret")
+	app.savePassword("/comics/b.cbr", "other")
+	if password, ok := app.loadSavedPassword("/comics/a.cbr"); !ok || password != "secret" {
+		t.Errorf("loadSavedPassword() = %q, %v, want %q, true", password, ok, "secret")
+	}
+
+	app.forgetPassword("/comics/a.cbr")
+	if _, ok := app.loadSavedPassword("/comics/a.cbr"); ok {
+		t.Error("the password is still saved after forgetting it")
+	}
+	if password, ok := app.loadSavedPassword("/comics/b.cbr"); !ok || password != "other" {
+		t.Errorf("loadSavedPassword() of another archive = %q, %v, want %q, true", password, ok, "other")
+	}
+
+	// Forgetting a password that isn't saved is a no-op
+	app.forgetPassword("/comics/a.cbr")
+}
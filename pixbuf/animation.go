@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package pixbuf
+
+// #cgo pkg-config: gdk-pixbuf-2.0
+// #cgo CFLAGS: -Wno-deprecated-declarations
+// #include <gdk-pixbuf/gdk-pixbuf.h>
+//
+// static const char *animationDataKey = "gomicsv-animation";
+//
+// static void set_animation(GdkPixbuf *p, GdkPixbufAnimation *a) {
+// 	g_object_set_data_full(G_OBJECT(p), animationDataKey, g_object_ref(a), g_object_unref);
+// }
+//
+// static GdkPixbufAnimation *get_animation(GdkPixbuf *p) {
+// 	return g_object_get_data(G_OBJECT(p), animationDataKey);
+// }
+//
+// static GdkPixbufAnimationIter *animation_get_iter(GdkPixbufAnimation *a, glong sec, glong usec) {
+// 	GTimeVal t = {sec, usec};
+// 	return gdk_pixbuf_animation_get_iter(a, &t);
+// }
+//
+// static gboolean animation_iter_advance(GdkPixbufAnimationIter *iter, glong sec, glong usec) {
+// 	GTimeVal t = {sec, usec};
+// 	return gdk_pixbuf_animation_iter_advance(iter, &t);
+// }
+import "C"
+
+import (
+	"errors"
+	"runtime"
+	"time"
+	"unsafe"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+)
+
+// Animation plays an animated image frame by frame. Its time passes only when it is advanced, so
+// that it can be paused and stepped through. Loop counts are respected
+type Animation struct {
+	anim    *C.GdkPixbufAnimation
+	iter    *C.GdkPixbufAnimationIter
+	start   time.Time
+	elapsed time.Duration
+}
+
+// AnimationOf returns a new player of the animation that p is the first frame of, or nil if p
+// is a still image
+func AnimationOf(p *gdk.Pixbuf) *Animation {
+	if p == nil {
+		return nil
+	}
+	anim := C.get_animation(nativePixbuf(p))
+	if anim == nil {
+		return nil
+	}
+
+	C.g_object_ref(C.gpointer(anim))
+	a := &Animation{anim: anim, start: time.Now()}
+	a.iter = C.animation_get_iter(anim, C.glong(a.start.Unix()), C.glong(a.start.Nanosecond()/1000))
+	runtime.SetFinalizer(a, (*Animation).free)
+
+	return a
+}
+
+func (a *Animation) free() {
+	C.g_object_unref(C.gpointer(a.iter))
+	C.g_object_unref(C.gpointer(a.anim))
+}
+
+// Delay returns how long the current frame should be shown for. Negative if it is the last one
+func (a *Animation) Delay() time.Duration {
+	ms := C.gdk_pixbuf_animation_iter_get_delay_time(a.iter)
+	if ms < 0 {
+		return -1
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// Advance moves to the next frame. Returns false if the animation has already ended
+func (a *Animation) Advance() bool {
+	delay := a.Delay()
+	if delay < 0 {
+		return false
+	}
+	a.elapsed += delay
+	t := a.start.Add(a.elapsed)
+	C.animation_iter_advance(a.iter, C.glong(t.Unix()), C.glong(t.Nanosecond()/1000))
+	return true
+}
+
+// Frame returns a copy of the current frame
+func (a *Animation) Frame() (*gdk.Pixbuf, error) {
+	return copyPixbuf(C.gdk_pixbuf_animation_iter_get_pixbuf(a.iter))
+}
+
+func isAnimated(anim *gdk.PixbufAnimation) bool {
+	return C.gdk_pixbuf_animation_is_static_image(nativeAnimation(anim)) == 0
+}
+
+// attachAnimation returns a copy of p from which anim can be retrieved with AnimationOf. (The copy
+// is needed because p might be owned by anim)
+func attachAnimation(p *gdk.Pixbuf, anim *gdk.PixbufAnimation) (*gdk.Pixbuf, error) {
+	animated, err := copyPixbuf(nativePixbuf(p))
+	if err != nil {
+		return nil, err
+	}
+	C.set_animation(nativePixbuf(animated), nativeAnimation(anim))
+
+	return animated, nil
+}
+
+func copyPixbuf(p *C.GdkPixbuf) (*gdk.Pixbuf, error) {
+	c := C.gdk_pixbuf_copy(p)
+	if c == nil {
+		return nil, errors.New("Could not copy the pixbuf")
+	}
+	return &gdk.Pixbuf{Object: glib.AssumeOwnership(unsafe.Pointer(c))}, nil
+}
+
+func nativePixbuf(p *gdk.Pixbuf) *C.GdkPixbuf {
+	return (*C.GdkPixbuf)(unsafe.Pointer(p.Native()))
+}
+
+func nativeAnimation(anim *gdk.PixbufAnimation) *C.GdkPixbufAnimation {
+	return (*C.GdkPixbufAnimation)(unsafe.Pointer(anim.Native()))
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package pixbuf
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"log"
+
+	"github.com/gotk3/gotk3/gdk"
+	_ "golang.org/x/image/webp"
+)
+
+// goFormat is an image format that can be decoded in Go when gdk-pixbuf has no loader for it.
+// Its decoder must be registered with the image package
+type goFormat struct {
+	name       string   // As registered with the image package
+	extensions []string // Without the leading "."
+}
+
+// AVIF and JPEG XL are deliberately missing: there are no pure Go decoders for them, so they are
+// left to the pixbuf loaders that come with libavif and libjxl
+var goFormats = []goFormat{
+	{name: "webp", extensions: []string{"webp"}},
+}
+
+// Formats for which there is no pixbuf loader, by name
+var fallbackFormats map[string]goFormat
+
+func init() {
+	supported := make(map[string]bool)
+	for _, format := range gdk.PixbufGetFormats() {
+		if name, err := format.GetName(); err == nil {
+			supported[name] = true
+		}
+	}
+
+	fallbackFormats = make(map[string]goFormat)
+	for _, format := range goFormats {
+		if !supported[format.name] {
+			fallbackFormats[format.name] = format
+			log.Printf("No pixbuf loader for %s, falling back to the Go decoder", format.name)
+		}
+	}
+}
+
+// Extensions returns the extensions (without the leading ".") of the image files that can be
+// loaded, whether by gdk-pixbuf or by a fallback decoder
+func Extensions() []string {
+	var extensions []string
+	for _, format := range gdk.PixbufGetFormats() {
+		extensions = append(extensions, format.GetExtensions()...)
+	}
+	for _, format := range fallbackFormats {
+		extensions = append(extensions, format.extensions...)
+	}
+	return extensions
+}
+
+// needsFallback reports whether data is an image in a format with no pixbuf loader
+func needsFallback(data []byte) bool {
+	if len(fallbackFormats) == 0 {
+		return false
+	}
+	_, name, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+	_, ok := fallbackFormats[name]
+	return ok
+}
+
+func loadFallback(data []byte) (*gdk.Pixbuf, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return FromImage(img)
+}
+
+// FromImage copies img into a new pixbuf
+func FromImage(img image.Image) (*gdk.Pixbuf, error) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= 0 || h <= 0 {
+		return nil, errors.New("Empty image")
+	}
+
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok || bounds.Min != (image.Point{}) {
+		nrgba = image.NewNRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+	}
+
+	pixbuf, err := gdk.PixbufNew(gdk.COLORSPACE_RGB, true, 8, w, h)
+	if err != nil {
+		return nil, err
+	}
+	pixels := pixbuf.GetPixels()
+	stride := pixbuf.GetRowstride()
+	for y := 0; y < h; y++ {
+		copy(pixels[y*stride:y*stride+w*4], nrgba.Pix[y*nrgba.Stride:y*nrgba.Stride+w*4])
+	}
+
+	return pixbuf, nil
+}
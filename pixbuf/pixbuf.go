@@ -27,18 +27,41 @@ import (
 )
 
 func Load(r io.Reader, autorotate bool) (*gdk.Pixbuf, error) {
-	w, _ := gdk.PixbufLoaderNew()
-	defer w.Close()
-	_, err := io.Copy(w, r)
+	data, err := io.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
+	return Decode(data, autorotate)
+}
+
+// Decode decodes an encoded image
+func Decode(data []byte, autorotate bool) (*gdk.Pixbuf, error) {
+	if needsFallback(data) {
+		pixbuf, err := loadFallback(data)
+		if err != nil || !autorotate {
+			return pixbuf, err
+		}
+		return pixbuf.ApplyEmbeddedOrientation()
+	}
+
+	w, _ := gdk.PixbufLoaderNew()
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return nil, err
+	}
+	// Finishes the animation, if there is one. A truncated image still yields what was decoded
+	w.Close()
 
 	pixbuf, err := w.GetPixbuf()
 	if err != nil {
 		return nil, err
 	}
 
+	if anim, err := w.GetAnimation(); err == nil && isAnimated(anim) {
+		// Embedded orientation is not applied to animations
+		return attachAnimation(pixbuf, anim)
+	}
+
 	if !autorotate {
 		return pixbuf, nil
 	}
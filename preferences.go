@@ -44,6 +44,21 @@ func (app *App) preferencesInit() {
 		app.Config.NSkip = int(self.GetValue())
 	})
 
+	app.W.PageCacheSizeSpinButton.SetRange(64, 16384)
+	app.W.PageCacheSizeSpinButton.SetIncrements(64, 512)
+	app.W.PageCacheSizeSpinButton.SetValue(float64(app.Config.PageCacheSize))
+	app.W.PageCacheSizeSpinButton.Connect("value-changed", func(self *gtk.SpinButton) {
+		app.setPageCacheSize(int(self.GetValue()))
+	})
+
+	app.W.HTTPCacheSizeSpinButton.SetRange(0, 65536)
+	app.W.HTTPCacheSizeSpinButton.SetIncrements(64, 1024)
+	app.W.HTTPCacheSizeSpinButton.SetValue(float64(app.Config.HTTPCacheSize))
+	app.W.HTTPCacheSizeSpinButton.Connect("value-changed", func(self *gtk.SpinButton) {
+		app.setHTTPCacheSize(int(self.GetValue()))
+	})
+	app.W.HTTPCacheClearButton.Connect("clicked", app.clearHTTPCache)
+
 	app.W.InterpolationComboBoxText.Connect("changed", func(self *gtk.ComboBoxText) {
 		app.setInterpolation(self.GetActive())
 	})
@@ -56,6 +71,14 @@ func (app *App) preferencesInit() {
 		app.setMangaModeReverseNavigation(self.GetActive())
 	})
 
+	app.W.RecursiveDirCheckButton.Connect("toggled", func(self *gtk.CheckButton) {
+		app.setRecursiveDir(self.GetActive())
+	})
+
+	app.W.HTTPProbeLengthCheckButton.Connect("toggled", func(self *gtk.CheckButton) {
+		app.setHTTPProbeLength(self.GetActive())
+	})
+
 	app.W.RememberRecentCheckButton.Connect("toggled", func(self *gtk.CheckButton) {
 		app.setRememberRecent(self.GetActive())
 	})
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gomicsv
+
+import (
+	"context"
+
+	"github.com/fauu/gomicsv/archive"
+	"github.com/fauu/gomicsv/pixbuf"
+)
+
+const prefetchWorkers = 2
+
+// prefetchAround starts decoding the pages likely to be viewed after the view starting at page n
+// into the page cache, cancelling what remains of the prefetching for the previous view
+func (app *App) prefetchAround(n int) {
+	forward := n >= app.S.PrefetchPos
+	app.S.PrefetchPos = n
+	app.prefetchCancel()
+
+	// HTTP archives preload the pages on their own
+	if app.S.Archive.Kind() == archive.HTTPKind {
+		return
+	}
+	pages := app.prefetchOrder(n, forward)
+	if len(pages) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app.S.PrefetchCancel = cancel
+
+	queue := make(chan int, len(pages))
+	for _, i := range pages {
+		queue <- i
+	}
+	close(queue)
+
+	ar, cache, autorotate := app.S.Archive, app.S.PageCache, app.Config.EmbeddedOrientation
+	for w := 0; w < prefetchWorkers; w++ {
+		go func() {
+			for i := range queue {
+				if ctx.Err() != nil {
+					return
+				}
+				if cache.Contains(i) {
+					continue
+				}
+				// Errors will be reported once the page is actually viewed
+				page, err := ar.Load(ctx, i, 0)
+				if err != nil || ctx.Err() != nil {
+					continue
+				}
+				pixbuf, err := pixbuf.Decode(page.Data, autorotate)
+				if err != nil || ctx.Err() != nil {
+					continue
+				}
+				cache.Insert(i, pixbuf)
+			}
+		}()
+	}
+}
+
+// prefetchOrder returns the pages to prefetch around the view starting at page n, the nearest
+// first. More pages are taken in the direction the reader is moving in. The direction is in terms
+// of page numbers, so it's the same in manga mode
+func (app *App) prefetchOrder(n int, forward bool) []int {
+	perView := 1
+	if app.Config.DoublePage {
+		perView = 2
+	}
+	ahead := app.Config.NPreload * perView
+	behind := max(app.Config.NPreload/2, 1) * perView
+	if !forward {
+		ahead, behind = behind, ahead
+	}
+
+	inBounds := func(i int) bool {
+		l := app.S.Archive.Len()
+		return i >= 0 && (l == nil || i < *l)
+	}
+
+	var after, before []int
+	for k := 0; k < ahead; k++ {
+		if i := n + perView + k; inBounds(i) {
+			after = append(after, i)
+		}
+	}
+	for k := 0; k < behind; k++ {
+		if i := n - 1 - k; inBounds(i) {
+			before = append(before, i)
+		}
+	}
+	if forward {
+		return append(after, before...)
+	}
+	return append(before, after...)
+}
+
+func (app *App) prefetchCancel() {
+	if app.S.PrefetchCancel != nil {
+		app.S.PrefetchCancel()
+		app.S.PrefetchCancel = nil
+	}
+}
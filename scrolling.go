@@ -99,7 +99,7 @@ func (app *App) scrollToStart() {
 	app.W.ScrolledWindow.GetVAdjustment().SetValue(0) // Vertical: top
 
 	var newHadj float64 = 0
-	if app.Config.MangaMode {
+	if app.mangaMode() {
 		imgw, _ := app.getImageAreaInnerSize()
 		newHadj = float64(imgw)
 	}
@@ -114,7 +114,7 @@ func (app *App) scrollToEnd() {
 	app.W.ScrolledWindow.GetVAdjustment().SetValue(float64(imgh)) // Vertical: bottom
 
 	var newHadj float64 = 0
-	if !app.Config.MangaMode {
+	if !app.mangaMode() {
 		newHadj = float64(imgw)
 	}
 	app.W.ScrolledWindow.SetHAdjustment(nil)
@@ -46,6 +46,8 @@ func (app *App) uiInit() {
 
 	app.imageAreaInit()
 
+	app.pageInit()
+
 	app.W.MainWindow.SetApplication(app.S.GTKApplication)
 	app.W.MainWindow.SetDefaultSize(app.Config.WindowWidth, app.Config.WindowHeight)
 	app.W.MainWindow.SetIcon(pixbuf.MustLoad(iconImg))
@@ -111,6 +113,8 @@ func (app *App) syncWidgetsToConfig() {
 	app.W.SmartScrollCheckButton.SetActive(app.Config.SmartScroll)
 	app.W.MangaModeReverseNavigationCheckButton.SetActive(app.Config.MangaModeReverseNavigation)
 	app.W.OneWideCheckButton.SetActive(app.Config.OneWide)
+	app.W.RecursiveDirCheckButton.SetActive(app.Config.RecursiveDir)
+	app.W.HTTPProbeLengthCheckButton.SetActive(app.Config.HTTPProbeLength)
 	app.W.RememberRecentCheckButton.SetActive(app.Config.RememberRecent)
 	app.W.RememberPositionCheckButton.SetActive(app.Config.RememberPosition)
 	app.W.RememberPositionHTTPCheckButton.SetActive(app.Config.RememberPositionHTTP)
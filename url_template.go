@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2013-2021 Utkan Güngördü <utkan@freeconsole.org>
+ * Copyright (c) 2021-2025 Piotr Grabowski
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program. If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package gomicsv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fauu/gomicsv/archive"
+	"github.com/fauu/gomicsv/util"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+func (app *App) urlTemplateDialogInit() {
+	_, err := app.W.URLTemplateDialog.AddButton("_Cancel", gtk.RESPONSE_CANCEL)
+	checkDialogAddButtonErr(err)
+	okButton, err := app.W.URLTemplateDialog.AddButton("_Open", gtk.RESPONSE_ACCEPT)
+	checkDialogAddButtonErr(err)
+
+	app.W.URLTemplateDialog.SetDefault(okButton)
+}
+
+// openURL opens the comic at url, given either the template followed by the page URLs or a sample
+// URL of one of the pages. The URLs of chapter pages to scrape images from are opened as they are.
+// The template is looked for in the background, and the user is asked to choose if it can't be
+// determined unambiguously
+func (app *App) openURL(url string, httpReferer string) {
+	app.urlTemplateInferenceCancel()
+
+	url = strings.TrimSpace(url)
+	if url == "" {
+		return
+	}
+	if !util.IsLikelyHTTPURL(url) {
+		url = "https://" + url
+	}
+	opts := app.archiveOptions(httpReferer)
+	if archive.IsPageURLTemplate(url) || archive.IsHTTPGalleryURL(url, opts) {
+		app.loadArchiveFromURL(url, httpReferer)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	app.S.URLTemplateInferenceCancel = cancel
+	app.notificationShow("Looking for the URLs of the other pages…", LongNotification)
+	go func() {
+		candidates, err := archive.InferURLTemplates(ctx, url, opts)
+
+		glib.IdleAdd(func() bool {
+			// Cancelled inferences have been superseded
+			if ctx.Err() != nil {
+				return false
+			}
+			app.urlTemplateInferenceCancel()
+			app.notificationHide()
+
+			if err == nil && len(candidates) == 0 {
+				err = errors.New("no URL template found")
+			}
+			if err != nil {
+				app.showError(fmt.Sprintf("Couldn't open %s: %v", url, err))
+				return false
+			}
+			template, ok := candidates[0].Template, true
+			if len(candidates) > 1 {
+				template, ok = app.urlTemplateDialogRun(candidates)
+			}
+			if ok {
+				app.loadArchiveFromURL(template, httpReferer)
+			}
+			return false
+		})
+	}()
+}
+
+// urlTemplateInferenceCancel abandons looking for the template of the URL being opened, if it's in
+// progress
+func (app *App) urlTemplateInferenceCancel() {
+	if app.S.URLTemplateInferenceCancel == nil {
+		return
+	}
+	app.S.URLTemplateInferenceCancel()
+	app.S.URLTemplateInferenceCancel = nil
+}
+
+// urlTemplateDialogRun asks the user which of the candidate templates the page URLs follow
+func (app *App) urlTemplateDialogRun(candidates []archive.URLTemplateCandidate) (template string, ok bool) {
+	prompt := "The page number could be in more than one place in the URL. Choose the template the page URLs follow:"
+	if !candidates[0].Verified {
+		prompt = "No other page could be found using any of the guessed templates. Choose the template the page URLs follow:"
+	}
+	app.W.URLTemplateDialogPromptLabel.SetText(prompt)
+	app.W.URLTemplateDialogComboBox.RemoveAll()
+	for _, c := range candidates {
+		app.W.URLTemplateDialogComboBox.AppendText(c.Template)
+	}
+	app.W.URLTemplateDialogComboBox.SetActive(0)
+
+	app.S.Cursor.ForceVisible = true
+	res := gtk.ResponseType(app.W.URLTemplateDialog.Run())
+	app.W.URLTemplateDialog.Hide()
+	app.S.Cursor.ForceVisible = false
+	if res != gtk.RESPONSE_ACCEPT {
+		return "", false
+	}
+
+	i := app.W.URLTemplateDialogComboBox.GetActive()
+	if i < 0 || i >= len(candidates) {
+		return "", false
+	}
+	return candidates[i].Template, true
+}
@@ -33,6 +33,10 @@ type Widgets struct {
 	ImageBox                              *gtk.Box               `build:"ImageBox"`
 	ImageL                                *gtk.Image             `build:"ImageL"`
 	ImageR                                *gtk.Image             `build:"ImageR"`
+	PagePlaceholder                       *gtk.Box               `build:"PagePlaceholder"`
+	PagePlaceholderLabel                  *gtk.Label             `build:"PagePlaceholderLabel"`
+	PagePlaceholderRetryButton            *gtk.Button            `build:"PagePlaceholderRetryButton"`
+	PageSpinner                           *gtk.Spinner           `build:"PageSpinner"`
 	NotificationRevealer                  *gtk.Revealer          `build:"NotificationRevealer"`
 	NotificationLabel                     *gtk.Label             `build:"NotificationLabel"`
 	NotificationCloseButton               *gtk.Button            `build:"NotificationCloseButton"`
@@ -44,6 +48,8 @@ type Widgets struct {
 	MenuNavigation                        *gtk.Menu              `build:"MenuNavigation"`
 	MenuBookmarks                         *gtk.Menu              `build:"MenuBookmarks"`
 	MenuJumpmarks                         *gtk.Menu              `build:"MenuJumpmarks"`
+	MenuItemChapters                      *gtk.MenuItem          `build:"MenuItemChapters"`
+	MenuChapters                          *gtk.Menu              `build:"MenuChapters"`
 	Statusbar                             *gtk.Statusbar         `build:"Statusbar"`
 	MenuItemOpen                          *gtk.MenuItem          `build:"MenuItemOpen"`
 	MenuItemOpenURL                       *gtk.MenuItem          `build:"MenuItemOpenURL"`
@@ -56,6 +62,27 @@ type Widgets struct {
 	OpenURLDialogURLEntry                 *gtk.Entry             `build:"OpenURLDialogURLEntry"`
 	OpenURLDialogExplanationLabel         *gtk.Label             `build:"OpenURLDialogExplanationLabel"`
 	OpenURLDialogRefererEntry             *gtk.Entry             `build:"OpenURLDialogRefererEntry"`
+	PasswordDialog                        *gtk.Dialog            `build:"PasswordDialog"`
+	PasswordDialogPromptLabel             *gtk.Label             `build:"PasswordDialogPromptLabel"`
+	PasswordDialogEntry                   *gtk.Entry             `build:"PasswordDialogEntry"`
+	PasswordDialogRememberCheckButton     *gtk.CheckButton       `build:"PasswordDialogRememberCheckButton"`
+	MenuItemForgetPassword                *gtk.MenuItem          `build:"MenuItemForgetPassword"`
+	URLTemplateDialog                     *gtk.Dialog            `build:"URLTemplateDialog"`
+	URLTemplateDialogPromptLabel          *gtk.Label             `build:"URLTemplateDialogPromptLabel"`
+	URLTemplateDialogComboBox             *gtk.ComboBoxText      `build:"URLTemplateDialogComboBoxText"`
+	MenuItemArchiveInfo                   *gtk.MenuItem          `build:"MenuItemArchiveInfo"`
+	ArchiveInfoDialog                     *gtk.Dialog            `build:"ArchiveInfoDialog"`
+	ArchiveInfoListStore                  *gtk.ListStore         `build:"ArchiveInfoListStore"`
+	ArchiveInfoPagesListStore             *gtk.ListStore         `build:"ArchiveInfoPagesListStore"`
+	MenuItemEditMetadata                  *gtk.MenuItem          `build:"MenuItemEditMetadata"`
+	EditMetadataDialog                    *gtk.Dialog            `build:"EditMetadataDialog"`
+	EditMetadataSeriesEntry               *gtk.Entry             `build:"EditMetadataSeriesEntry"`
+	EditMetadataNumberEntry               *gtk.Entry             `build:"EditMetadataNumberEntry"`
+	EditMetadataVolumeEntry               *gtk.Entry             `build:"EditMetadataVolumeEntry"`
+	EditMetadataTitleEntry                *gtk.Entry             `build:"EditMetadataTitleEntry"`
+	EditMetadataReadingDirectionComboBox  *gtk.ComboBoxText      `build:"EditMetadataReadingDirectionComboBoxText"`
+	EditMetadataPagesListStore            *gtk.ListStore         `build:"EditMetadataPagesListStore"`
+	EditMetadataPageTypeCellRenderer      *gtk.CellRendererCombo `build:"EditMetadataPageTypeCellRenderer"`
 	Toolbar                               *gtk.Toolbar           `build:"Toolbar"`
 	ButtonPageLeft                        *gtk.ToolButton        `build:"ButtonPreviousPage"`
 	ButtonPageRight                       *gtk.ToolButton        `build:"ButtonNextPage"`
@@ -85,6 +112,8 @@ type Widgets struct {
 	MenuItemVFlip                         *gtk.CheckMenuItem     `build:"MenuItemVFlip"`
 	MenuItemMangaMode                     *gtk.CheckMenuItem     `build:"MenuItemMangaMode"`
 	MenuItemDoublePage                    *gtk.CheckMenuItem     `build:"MenuItemDoublePage"`
+	MenuItemAnimationPause                *gtk.CheckMenuItem     `build:"MenuItemAnimationPause"`
+	MenuItemAnimationStep                 *gtk.MenuItem          `build:"MenuItemAnimationStep"`
 	MenuItemGoTo                          *gtk.MenuItem          `build:"MenuItemGoTo"`
 	MenuItemBestFit                       *gtk.RadioMenuItem     `build:"MenuItemBestFit"`
 	MenuItemOriginal                      *gtk.RadioMenuItem     `build:"MenuItemOriginal"`
@@ -99,9 +128,14 @@ type Widgets struct {
 	PreferencesDialog                     *gtk.Dialog            `build:"PreferencesDialog"`
 	BackgroundColorButton                 *gtk.ColorButton       `build:"BackgroundColorButton"`
 	PagesToSkipSpinButton                 *gtk.SpinButton        `build:"PagesToSkipSpinButton"`
+	PageCacheSizeSpinButton               *gtk.SpinButton        `build:"PageCacheSizeSpinButton"`
+	HTTPCacheSizeSpinButton               *gtk.SpinButton        `build:"HTTPCacheSizeSpinButton"`
+	HTTPCacheClearButton                  *gtk.Button            `build:"HTTPCacheClearButton"`
 	InterpolationComboBoxText             *gtk.ComboBoxText      `build:"InterpolationComboBoxText"`
 	SmartScrollCheckButton                *gtk.CheckButton       `build:"SmartScrollCheckButton"`
 	MangaModeReverseNavigationCheckButton *gtk.CheckButton       `build:"MangaModeReverseNavigationCheckButton"`
+	RecursiveDirCheckButton               *gtk.CheckButton       `build:"RecursiveDirCheckButton"`
+	HTTPProbeLengthCheckButton            *gtk.CheckButton       `build:"HTTPProbeLengthCheckButton"`
 	RememberRecentCheckButton             *gtk.CheckButton       `build:"RememberRecentCheckButton"`
 	RememberPositionCheckButton           *gtk.CheckButton       `build:"RememberPositionCheckButton"`
 	RememberPositionHTTPCheckButton       *gtk.CheckButton       `build:"RememberPositionHTTPCheckButton"`
@@ -116,6 +150,8 @@ type Widgets struct {
 	MenuItemCycleJumpmarksBackward        *gtk.MenuItem          `build:"CycleJumpmarksBackwardMenuItem"`
 	MenuItemCycleJumpmarksForward         *gtk.MenuItem          `build:"CycleJumpmarksForwardMenuItem"`
 	MenuItemJumpmarksReturnFromCycling    *gtk.MenuItem          `build:"JumpmarksReturnFromCyclingMenuItem"`
+	MenuItemPreviousChapter               *gtk.MenuItem          `build:"MenuItemPreviousChapter"`
+	MenuItemNextChapter                   *gtk.MenuItem          `build:"MenuItemNextChapter"`
 	RecentChooserMenu                     *gtk.RecentChooserMenu `build:"RecentChooserMenu"`
 }
 